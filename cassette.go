@@ -0,0 +1,276 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/epuerta9/box-ee-cli/pkg/boxee"
+)
+
+var (
+	ErrorRecordAndReplay = errors.New("--record and --replay cannot be used together")
+	ErrorNoReplay        = errors.New("no recorded response")
+)
+
+// cassetteInteraction is one request and its response as saved by --record.
+// Error is set instead of Response when the request failed before a response
+// arrived
+type cassetteInteraction struct {
+	Request  cassetteRequest   `json:"request"`
+	Response *cassetteResponse `json:"response,omitempty"`
+	Error    string            `json:"error,omitempty"`
+}
+
+type cassetteRequest struct {
+	Method string      `json:"method"`
+	URL    string      `json:"url"`
+	Header http.Header `json:"header,omitempty"`
+	Body   string      `json:"body,omitempty"`
+}
+
+type cassetteResponse struct {
+	Status int         `json:"status"`
+	Header http.Header `json:"header,omitempty"`
+	Body   string      `json:"body,omitempty"`
+}
+
+// cassetteKey identifies the request an interaction answers. The host is left
+// out so a cassette replays against any address
+func cassetteKey(method, rawURL string) string {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return method + " " + rawURL
+	}
+	clean, _ := url.Parse(redactURL(u))
+	return method + " " + clean.Path + "?" + clean.Query().Encode()
+}
+
+// recorder numbers the interactions written to a cassette directory. It is
+// shared by every client of a run and continues after the files already in
+// the directory, so several commands can be recorded into one cassette
+type recorder struct {
+	dir string
+	mu  sync.Mutex
+	seq int
+}
+
+// sharedRecorder returns the recorder of the run for dir
+func (s *runState) sharedRecorder(dir string) (*recorder, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.recorder != nil && s.recorder.dir == dir {
+		return s.recorder, nil
+	}
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, err
+	}
+	existing, err := filepath.Glob(filepath.Join(dir, "*.json"))
+	if err != nil {
+		return nil, err
+	}
+	s.recorder = &recorder{dir: dir, seq: lastCassetteSeq(existing)}
+	return s.recorder, nil
+}
+
+// lastCassetteSeq returns the highest number of the cassette files. Counting
+// the files would reuse a number once one of them was deleted
+func lastCassetteSeq(files []string) int {
+	last := 0
+	for _, f := range files {
+		prefix, _, _ := strings.Cut(filepath.Base(f), "-")
+		if n, err := strconv.Atoi(prefix); err == nil && n > last {
+			last = n
+		}
+	}
+	return last
+}
+
+var slugUnsafe = regexp.MustCompile(`[^a-z0-9]+`)
+
+// save writes the interaction to the next numbered file, named after the
+// request so a cassette can be read without opening every file
+func (r *recorder) save(in cassetteInteraction) error {
+	raw, err := json.MarshalIndent(in, "", "  ")
+	if err != nil {
+		return err
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.seq++
+	name := strings.ToLower(in.Request.Method)
+	if u, err := url.Parse(in.Request.URL); err == nil {
+		name += "-" + strings.Trim(slugUnsafe.ReplaceAllString(strings.ToLower(u.Path), "-"), "-")
+	}
+	return ioutil.WriteFile(filepath.Join(r.dir, fmt.Sprintf("%04d-%v.json", r.seq, name)), append(raw, '\n'), 0600)
+}
+
+// recordingDoer saves every request sent through next and its response to a
+// cassette. Secrets are redacted like in --trace, so a cassette can be
+// attached to a bug report
+type recordingDoer struct {
+	next boxee.HttpRequestDoer
+	rec  *recorder
+	// secretHeaders are redacted besides sensitiveHeaders, see extraHeaderNames
+	secretHeaders map[string]bool
+}
+
+func (d *recordingDoer) Do(req *http.Request) (*http.Response, error) {
+	in := cassetteInteraction{Request: cassetteRequest{
+		Method: req.Method,
+		URL:    redactURL(req.URL),
+		Header: redactHeaders(req.Header, d.secretHeaders),
+	}}
+	if req.GetBody != nil {
+		if body, err := req.GetBody(); err == nil {
+			raw, _ := ioutil.ReadAll(body)
+			body.Close()
+			in.Request.Body = string(redactBody(raw))
+		}
+	}
+	resp, err := d.next.Do(req)
+	if err != nil {
+		in.Error = err.Error()
+		if saveErr := d.rec.save(in); saveErr != nil {
+			return nil, fmt.Errorf("recording %v %v: %w", req.Method, redactURL(req.URL), saveErr)
+		}
+		return resp, err
+	}
+	raw, err := ioutil.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+	resp.Body = ioutil.NopCloser(bytes.NewReader(raw))
+	in.Response = &cassetteResponse{
+		Status: resp.StatusCode,
+		Header: redactHeaders(resp.Header, d.secretHeaders),
+		Body:   string(redactBody(raw)),
+	}
+	if err := d.rec.save(in); err != nil {
+		return nil, fmt.Errorf("recording %v %v: %w", req.Method, redactURL(req.URL), err)
+	}
+	return resp, nil
+}
+
+// replayer serves the interactions of a cassette. Each one answers a single
+// request, in the order they were recorded
+type replayer struct {
+	dir          string
+	mu           sync.Mutex
+	interactions []cassetteInteraction
+	used         []bool
+}
+
+// sharedReplayer returns the replayer of the run for dir
+func (s *runState) sharedReplayer(dir string) (*replayer, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.replayer != nil && s.replayer.dir == dir {
+		return s.replayer, nil
+	}
+	files, err := filepath.Glob(filepath.Join(dir, "*.json"))
+	if err != nil {
+		return nil, err
+	}
+	if len(files) == 0 {
+		return nil, fmt.Errorf("no recorded requests in %v. Record them with --record", dir)
+	}
+	sort.Strings(files)
+	r := &replayer{dir: dir, used: make([]bool, len(files))}
+	for _, f := range files {
+		raw, err := ioutil.ReadFile(f)
+		if err != nil {
+			return nil, err
+		}
+		var in cassetteInteraction
+		if err := json.Unmarshal(raw, &in); err != nil {
+			return nil, fmt.Errorf("invalid cassette file %v: %w", f, err)
+		}
+		r.interactions = append(r.interactions, in)
+	}
+	s.replayer = r
+	return r, nil
+}
+
+// replayDoer answers requests from a cassette without touching the network
+type replayDoer struct {
+	r *replayer
+}
+
+func (d replayDoer) Do(req *http.Request) (*http.Response, error) {
+	if err := req.Context().Err(); err != nil {
+		return nil, err
+	}
+	var body string
+	if req.GetBody != nil {
+		if b, err := req.GetBody(); err == nil {
+			raw, _ := ioutil.ReadAll(b)
+			b.Close()
+			body = string(redactBody(raw))
+		}
+	}
+	in, ok := d.r.next(cassetteKey(req.Method, req.URL.String()), body)
+	if !ok {
+		return nil, fmt.Errorf("%w for %v %v in %v", ErrorNoReplay, req.Method, redactURL(req.URL), d.r.dir)
+	}
+	if in.Response == nil {
+		return nil, errors.New(in.Error)
+	}
+	return &http.Response{
+		Status:        fmt.Sprintf("%d %v", in.Response.Status, http.StatusText(in.Response.Status)),
+		StatusCode:    in.Response.Status,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        in.Response.Header.Clone(),
+		Body:          ioutil.NopCloser(strings.NewReader(in.Response.Body)),
+		ContentLength: int64(len(in.Response.Body)),
+		Request:       req,
+	}, nil
+}
+
+// next takes the first unused interaction for key, preferring one recorded
+// with the same body
+func (r *replayer) next(key, body string) (cassetteInteraction, bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	match := -1
+	for i, in := range r.interactions {
+		if r.used[i] || cassetteKey(in.Request.Method, in.Request.URL) != key {
+			continue
+		}
+		if in.Request.Body == body {
+			match = i
+			break
+		}
+		if match < 0 {
+			match = i
+		}
+	}
+	if match < 0 {
+		return cassetteInteraction{}, false
+	}
+	r.used[match] = true
+	return r.interactions[match], true
+}
+
+// replayStore stands in for the credential store while replaying. The secrets
+// of a cassette are redacted, so every lookup finds the redacted placeholder
+// and nothing replayed is saved over real credentials
+type replayStore struct{}
+
+func (replayStore) Get(name string) (string, error) { return redacted, nil }
+func (replayStore) Set(name, value string) error    { return nil }
+func (replayStore) Delete(name string) error        { return nil }
@@ -0,0 +1,82 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/epuerta9/box-ee-cli/pkg/boxeetest"
+)
+
+// flakyDeviceList is a cassette of a device list that failed once before the
+// retry succeeded, as a teammate would attach it to a ticket
+var flakyDeviceList = map[string]string{
+	"cassette/0001-get-api-v1-device-list.json": `{
+  "request": {"method": "GET", "url": "https://api.box-ee.com/api/v1/device/list?limit=20&page=1"},
+  "response": {"status": 502, "body": "upstream timeout"}
+}`,
+	"cassette/0002-get-api-v1-device-list.json": `{
+  "request": {"method": "GET", "url": "https://api.box-ee.com/api/v1/device/list?limit=20&page=1"},
+  "response": {
+    "status": 200,
+    "header": {"Content-Type": ["application/json"]},
+    "body": "{\"count\":1,\"devices\":[{\"health\":0,\"id\":\"dev-0042\",\"name\":\"garage\",\"trackings\":[],\"type\":\"main\"}],\"msg\":\"devices listed\",\"status_code\":200}"
+  }
+}`,
+}
+
+func TestCassettes(t *testing.T) {
+	//Reset empties the fake api, a replayed run that reached it would fail
+	offline := func(srv *boxeetest.Server) { srv.Reset() }
+	runCLICases(t, []cliCase{
+		{
+			name: "cassette/record",
+			args: []string{"tracking", "list", "--device-id", "dev-0002", "--record", "cassette"},
+			show: []string{"cassette/0001-get-api-v1-tracking-list.json"},
+		},
+		{
+			name:   "cassette/record_login",
+			args:   []string{"login", "--password-stdin", "--record", "cassette"},
+			stdin:  "Correct-Horse-9\n",
+			config: loggedOutConfig,
+			show:   []string{"cassette/0001-post-api-v1-self-service-login.json"},
+		},
+		{
+			name:   "cassette/record_appends",
+			args:   []string{"tracking", "delete", "--id", "trk-0001", "--record", "cassette"},
+			before: [][]string{{"device", "list", "--record", "cassette"}},
+			show:   []string{"cassette/0002-delete-api-v1-tracking.json"},
+		},
+		{
+			name: "cassette/record_extra_header",
+			args: []string{"device", "list", "--record", "cassette", "--header", "X-Api-Key: s3cr3t-gateway-key"},
+			show: []string{"cassette/0001-get-api-v1-device-list.json"},
+		},
+		{
+			name: "cassette/record_after_delete",
+			args: []string{"device", "list", "--record", "cassette"},
+			//0001 was deleted, counting the files would overwrite 0002
+			files: map[string]string{"cassette/0002-get-api-v1-device-list.json": flakyDeviceList["cassette/0002-get-api-v1-device-list.json"]},
+			show:  []string{"cassette/0002-get-api-v1-device-list.json", "cassette/0003-get-api-v1-device-list.json"},
+		},
+		{
+			name:   "cassette/replay",
+			args:   []string{"tracking", "list", "--device-id", "dev-0002", "--replay", "cassette", "-o", "table"},
+			before: [][]string{{"tracking", "list", "--device-id", "dev-0002", "--record", "cassette"}},
+			setup:  offline,
+		},
+		{
+			name:     "cassette/replay_without_config",
+			args:     []string{"device", "list", "--replay", "cassette", "-o", "table"},
+			noConfig: true,
+			files:    flakyDeviceList,
+			setup:    offline,
+		},
+		{
+			name:     "cassette/replay_missing_request",
+			args:     []string{"tracking", "list", "--replay", "cassette"},
+			noConfig: true,
+			files:    flakyDeviceList,
+		},
+		{name: "cassette/replay_empty", args: []string{"device", "list", "--replay", "cassette"}},
+		{name: "cassette/record_and_replay", args: []string{"device", "list", "--record", "a", "--replay", "b"}},
+	})
+}
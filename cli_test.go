@@ -0,0 +1,348 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/epuerta9/box-ee-cli/pkg/boxee"
+	"github.com/epuerta9/box-ee-cli/pkg/boxeetest"
+)
+
+var update = flag.Bool("update", false, "rewrite the golden files in testdata")
+
+// testAddress is the address of the fake api. Requests never leave the
+// process, handlerDoer hands them to the mock
+const testAddress = "http://boxee.test"
+
+// testNow is the clock of the fake api
+var testNow = time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+
+// loggedInConfig is the project config of most cases: logged in as
+// qa@example.com with fast retries and secrets kept in the config file
+const loggedInConfig = `address: http://boxee.test
+email: qa@example.com
+credential_store: plaintext
+retry:
+  base_delay: 1ms
+  max_delay: 5ms
+credentials:
+  qa@example.com@http://boxee.test/session_token: sess_qa
+  qa@example.com@http://boxee.test/session_issued: "2024-03-01T11:00:00Z"
+`
+
+// loggedOutConfig is loggedInConfig without a session
+const loggedOutConfig = `address: http://boxee.test
+email: qa@example.com
+credential_store: plaintext
+retry:
+  base_delay: 1ms
+  max_delay: 5ms
+`
+
+// testFixtures is the state of the fake api at the start of every case
+func testFixtures() boxeetest.Fixtures {
+	return boxeetest.Fixtures{
+		Users: []boxeetest.UserFixture{
+			{Email: "qa@example.com", Password: "Correct-Horse-9", SessionToken: "sess_qa"},
+			{Email: "other@example.com", Password: "Other-Horse-9"},
+		},
+		Devices: []boxeetest.DeviceFixture{
+			{
+				ID:        "dev-0001",
+				Name:      "locker-1",
+				Type:      "main",
+				Health:    1,
+				ClientKey: "ck_locker",
+				Trackings: []boxeetest.TrackingFixture{
+					{ID: "trk-0001", TrackingNumber: "T100", PinKey: "111111"},
+					{ID: "trk-0002", TrackingNumber: "T101", PinKey: "222222"},
+				},
+			},
+			{
+				ID:     "dev-0002",
+				Name:   "locker-2",
+				Type:   "side",
+				Prefix: "L2",
+				Trackings: []boxeetest.TrackingFixture{
+					{ID: "trk-0003", TrackingNumber: "T200", PinKey: "333333"},
+				},
+			},
+			{ID: "dev-0003", Name: "other-locker", Type: "main", Owner: "other@example.com"},
+		},
+	}
+}
+
+// cliCase is a boxee invocation compared with testdata/<name>.golden
+type cliCase struct {
+	name string
+	args []string
+	// stdin is fed to the command, env is set for the run
+	stdin string
+	env   map[string]string
+	// config is the .box-ee.yaml of the work dir, loggedInConfig when empty.
+	// Set noConfig to start without any config file
+	config   string
+	noConfig bool
+	// files are written to the work dir before the run
+	files map[string]string
+	// before runs commands that have to succeed first
+	before [][]string
+	// setup changes the fake api before the run
+	setup func(srv *boxeetest.Server)
+	// show lists work dir files whose content is added to the golden file
+	// after the run
+	show []string
+}
+
+// cliHarness runs boxee in-process against a fresh fake api with its own work
+// and config directories
+type cliHarness struct {
+	t         *testing.T
+	srv       *boxeetest.Server
+	workDir   string
+	configDir string
+}
+
+func newCLIHarness(t *testing.T) *cliHarness {
+	t.Helper()
+	h := &cliHarness{
+		t:         t,
+		srv:       boxeetest.New(boxeetest.WithFixtures(testFixtures()), boxeetest.WithSeed(1), boxeetest.WithClock(func() time.Time { return testNow })),
+		workDir:   t.TempDir(),
+		configDir: t.TempDir(),
+	}
+	previous := systemConfigPath
+	systemConfigPath = filepath.Join(h.configDir, "system.yaml")
+	t.Cleanup(func() {
+		systemConfigPath = previous
+	})
+	for _, name := range []string{
+		"BOXEE_ADDRESS", "BOXEE_EMAIL", "BOXEE_CONTEXT", "BOXEE_CREDENTIAL_STORE", "BOXEE_CREDENTIAL_FILE",
+		"BOXEE_CLIENT_KEY", passphraseEnvName, strictSecretsEnvName, "VERSION", "VISUAL", "EDITOR",
+		"HTTP_PROXY", "HTTPS_PROXY", "http_proxy", "https_proxy",
+	} {
+		t.Setenv(name, "")
+	}
+	return h
+}
+
+// handlerDoer hands requests straight to an http.Handler
+type handlerDoer struct {
+	h http.Handler
+}
+
+func (d handlerDoer) Do(req *http.Request) (*http.Response, error) {
+	if err := req.Context().Err(); err != nil {
+		return nil, err
+	}
+	rec := httptest.NewRecorder()
+	d.h.ServeHTTP(rec, req)
+	return rec.Result(), nil
+}
+
+// run executes boxee with args and returns stdout, stderr and the exit code
+func (h *cliHarness) run(ctx context.Context, stdin string, args ...string) (string, string, int) {
+	var stdout, stderr bytes.Buffer
+	env := &cliEnv{
+		Stdin:      strings.NewReader(stdin),
+		Stdout:     &stdout,
+		Stderr:     &stderr,
+		ConfigDir:  h.configDir,
+		WorkDir:    h.workDir,
+		HTTPClient: handlerDoer{h: h.srv},
+	}
+	code := run(ctx, env, args)
+	return stdout.String(), stderr.String(), code
+}
+
+func (h *cliHarness) writeFile(name, content string) {
+	h.t.Helper()
+	path := filepath.Join(h.workDir, name)
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		h.t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(path, []byte(content), 0600); err != nil {
+		h.t.Fatal(err)
+	}
+}
+
+func (h *cliHarness) readFile(name string) string {
+	h.t.Helper()
+	raw, err := ioutil.ReadFile(filepath.Join(h.workDir, name))
+	if err != nil {
+		return fmt.Sprintf("<%v>", err)
+	}
+	return string(raw)
+}
+
+// volatile matches output that changes between runs
+var volatile = []struct {
+	re   *regexp.Regexp
+	with string
+}{
+	{regexp.MustCompile(`in [0-9.]+(µs|ms|s)( \()`), "in <delay>$2"},
+	{regexp.MustCompile(`(\d+ requests in )[^ ]+ \([0-9.]+ req/s\)`), "${1}<elapsed> (<rate> req/s)"},
+	{regexp.MustCompile(`("token_age":")[^"]*"`), `${1}<age>"`},
+	{regexp.MustCompile(`(?m)^(token_age: ).*$`), `${1}<age>`},
+	//logins and imports stamp the wall clock, not the clock of the fake api
+	{regexp.MustCompile(`(session_issued: |logged_in_at: |"logged_in_at":|"added":)"20[0-9T:.\-]+Z"`), `${1}"<now>"`},
+	{regexp.MustCompile(`127\.0\.0\.1:\d+`), "127.0.0.1:<port>"},
+	{regexp.MustCompile(`boxee-\d+\.yaml`), "boxee-<tmp>.yaml"},
+}
+
+// scrub replaces temp dirs and volatile values so output can be compared.
+// Temp dirs change length between runs, cases that print them should not use
+// aligned table output
+func (h *cliHarness) scrub(s string) string {
+	s = strings.ReplaceAll(s, h.workDir, "<work>")
+	s = strings.ReplaceAll(s, h.configDir, "<config>")
+	s = strings.ReplaceAll(s, os.TempDir(), "<tmp>")
+	for _, v := range volatile {
+		s = v.re.ReplaceAllString(s, v.with)
+	}
+	return s
+}
+
+// runCLICases runs every case and compares its output with the golden file
+func runCLICases(t *testing.T, cases []cliCase) {
+	t.Helper()
+	for _, c := range cases {
+		c := c
+		t.Run(c.name, func(t *testing.T) {
+			h := newCLIHarness(t)
+			for name, value := range c.env {
+				t.Setenv(name, value)
+			}
+			if !c.noConfig {
+				config := c.config
+				if config == "" {
+					config = loggedInConfig
+				}
+				h.writeFile(configFile, config)
+			}
+			for name, content := range c.files {
+				h.writeFile(name, content)
+			}
+			for _, args := range c.before {
+				if stdout, stderr, code := h.run(context.Background(), "", args...); code != 0 {
+					t.Fatalf("boxee %v exited %d\n%v%v", strings.Join(args, " "), code, stdout, stderr)
+				}
+			}
+			if c.setup != nil {
+				c.setup(h.srv)
+			}
+
+			stdout, stderr, code := h.run(context.Background(), c.stdin, c.args...)
+			var got strings.Builder
+			fmt.Fprintf(&got, "$ boxee %v\n", strings.Join(c.args, " "))
+			fmt.Fprintf(&got, "--- stdout\n%v", stdout)
+			fmt.Fprintf(&got, "--- stderr\n%v", stderr)
+			fmt.Fprintf(&got, "--- exit %d\n", code)
+			for _, name := range c.show {
+				fmt.Fprintf(&got, "--- file %v\n%v", name, h.readFile(name))
+			}
+			compareGolden(t, c.name, h.scrub(got.String()))
+		})
+	}
+}
+
+// compareGolden checks got against testdata/<name>.golden, or rewrites the
+// file when the tests run with -update
+func compareGolden(t *testing.T, name, got string) {
+	t.Helper()
+	path := filepath.Join("testdata", name+".golden")
+	if *update {
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(path, []byte(got), 0644); err != nil {
+			t.Fatal(err)
+		}
+		return
+	}
+	want, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatalf("%v. Run go test -update to create it", err)
+	}
+	if got != string(want) {
+		t.Errorf("output differs from %v, run go test -update and review the diff\n--- got\n%v--- want\n%v", path, got, want)
+	}
+}
+
+func TestRunResetsFlagsBetweenRuns(t *testing.T) {
+	h := newCLIHarness(t)
+	h.writeFile(configFile, loggedInConfig)
+	if _, _, code := h.run(context.Background(), "", "tracking", "list", "--device-id", "dev-0002"); code != 0 {
+		t.Fatalf("first run exited %d", code)
+	}
+	//a device id left over from the first run would filter this list
+	stdout, _, code := h.run(context.Background(), "", "tracking", "list", "-o", "jsonpath={.count}")
+	if code != 0 || strings.TrimSpace(stdout) != "3" {
+		t.Fatalf("second run got %q exit %d, want 3 trackings", stdout, code)
+	}
+}
+
+func TestRunInterrupted(t *testing.T) {
+	h := newCLIHarness(t)
+	h.writeFile(configFile, loggedInConfig)
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, _, code := h.run(ctx, "", "device", "list"); code != ExitInterrupted {
+		t.Fatalf("exit %d, want %d", code, ExitInterrupted)
+	}
+}
+
+func TestRootCommands(t *testing.T) {
+	runCLICases(t, []cliCase{
+		{name: "root/help", args: []string{"--help"}},
+		{name: "root/unknown_command", args: []string{"nope"}},
+		{name: "root/unknown_flag", args: []string{"device", "list", "--nope"}},
+		{name: "root/missing_argument", args: []string{"config", "get"}},
+		{name: "root/unknown_output", args: []string{"device", "list", "-o", "xml"}},
+		{name: "root/version", args: []string{"version"}},
+		{name: "root/version_env", args: []string{"version"}, env: map[string]string{"VERSION": "9.9.9"}},
+		{name: "root/no_config", args: []string{"device", "list"}, noConfig: true},
+		{name: "root/address_flag_without_config", args: []string{"device", "list", "--address", testAddress}, noConfig: true},
+	})
+}
+
+// stubClients hands out clients of the fake api logged in as qa@example.com
+// without reading any config, for options run without cobra
+type stubClients struct {
+	srv *boxeetest.Server
+}
+
+func (c stubClients) SessionClient() (*boxee.API, ConfigParams, error) {
+	cParams := ConfigParams{Email: "qa@example.com", Address: testAddress, SessionToken: "sess_qa"}
+	api, err := c.Client(cParams, boxee.WithSessionToken(cParams.SessionToken))
+	return api, cParams, err
+}
+
+func (c stubClients) Client(cParams ConfigParams, opts ...boxee.ClientOption) (*boxee.API, error) {
+	return boxee.New(cParams.Address, append([]boxee.ClientOption{boxee.WithHTTPClient(handlerDoer{h: c.srv})}, opts...)...)
+}
+
+// stubDeps are command dependencies writing to out and talking to srv, with
+// the default global flags
+func stubDeps(srv *boxeetest.Server, out *bytes.Buffer) cmdDeps {
+	env := &cliEnv{Stdin: strings.NewReader(""), Stdout: out, Stderr: ioutil.Discard}
+	return cmdDeps{
+		ioStreams: ioStreams{In: env.Stdin, Out: out, ErrOut: env.Stderr},
+		Clients:   stubClients{srv: srv},
+		Config: func() (ConfigParams, error) {
+			return ConfigParams{Email: "qa@example.com", Address: testAddress}, nil
+		},
+		state: newRunState(env),
+	}
+}
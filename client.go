@@ -0,0 +1,43 @@
+package main
+
+import (
+	"github.com/epuerta9/box-ee-cli/pkg/boxee"
+)
+
+// newAPIClient builds the api client for the configured server on top of the
+// cli transport. opts are applied after the extra headers and normally add
+// authentication
+func (s *runState) newAPIClient(cParams ConfigParams, opts ...boxee.ClientOption) (*boxee.API, error) {
+	doer, err := s.newHTTPDoer(cParams.Transport)
+	if err != nil {
+		return nil, err
+	}
+	return boxee.New(cParams.Address, append([]boxee.ClientOption{
+		boxee.WithHTTPClient(doer),
+		boxee.WithRequestEditorFn(setExtraHeaders(cParams.Transport.Headers)),
+	}, opts...)...)
+}
+
+// newSessionClient reads the config and returns a client authenticated with
+// the session token from boxee login. It is the only place the token is read
+// from the credential store, which may prompt for a passphrase
+func (s *runState) newSessionClient() (*boxee.API, ConfigParams, error) {
+	if err := s.readConfig(); err != nil {
+		return nil, ConfigParams{}, err
+	}
+	cParams, err := s.resolveConfigParams()
+	if err != nil {
+		return nil, cParams, err
+	}
+	if cParams.SessionToken, err = s.readCredential(cParams, credSessionToken); err != nil {
+		return nil, cParams, err
+	}
+	if cParams.SessionToken == "" {
+		return nil, cParams, ErrNotLoggedIn
+	}
+	api, err := s.newAPIClient(cParams, boxee.WithSessionToken(cParams.SessionToken))
+	if err != nil {
+		return nil, cParams, err
+	}
+	return api, cParams, nil
+}
@@ -0,0 +1,84 @@
+package main
+
+import (
+	"io"
+
+	"github.com/epuerta9/box-ee-cli/pkg/boxee"
+)
+
+// ioStreams are the streams a command reads its input from and writes its
+// results and messages to
+type ioStreams struct {
+	In     io.Reader
+	Out    io.Writer
+	ErrOut io.Writer
+}
+
+// clientFactory builds the api clients commands talk to the server with
+type clientFactory interface {
+	// SessionClient returns a client authenticated with the session token
+	// from boxee login, and the settings it was built from
+	SessionClient() (*boxee.API, ConfigParams, error)
+	// Client returns a client for cParams. opts add authentication such as
+	// boxee.WithClientKey
+	Client(cParams ConfigParams, opts ...boxee.ClientOption) (*boxee.API, error)
+}
+
+// configClients is the clientFactory of the cli. Clients are built from the
+// layered config and the credential store
+type configClients struct {
+	state *runState
+}
+
+func (c configClients) SessionClient() (*boxee.API, ConfigParams, error) {
+	return c.state.newSessionClient()
+}
+
+func (c configClients) Client(cParams ConfigParams, opts ...boxee.ClientOption) (*boxee.API, error) {
+	return c.state.newAPIClient(cParams, opts...)
+}
+
+// cmdDeps are the dependencies commands are constructed with. Options structs
+// embed them so Run can be called without cobra
+type cmdDeps struct {
+	ioStreams
+	Clients clientFactory
+	// Config reads the config files and returns the account, server and
+	// transport settings of the active context. Secrets are not resolved
+	Config func() (ConfigParams, error)
+	// state holds the global flags and the loaded config of the run
+	state *runState
+}
+
+// newCmdDeps returns the dependencies of a run of boxee with state
+func newCmdDeps(state *runState) cmdDeps {
+	env := state.env
+	return cmdDeps{
+		ioStreams: ioStreams{In: env.Stdin, Out: env.Stdout, ErrOut: env.Stderr},
+		Clients:   configClients{state: state},
+		Config:    state.loadConfigParams,
+		state:     state,
+	}
+}
+
+// loadConfigParams reads every config layer and resolves the active context
+func (s *runState) loadConfigParams() (ConfigParams, error) {
+	if err := s.readConfig(); err != nil {
+		return ConfigParams{}, err
+	}
+	return s.resolveConfigParams()
+}
+
+// print writes v to Out in the format of --output
+func (d cmdDeps) print(v interface{}) error {
+	return d.printAs(d.state.flags.Output, v)
+}
+
+// printAs writes v to Out in format
+func (d cmdDeps) printAs(format string, v interface{}) error {
+	p, err := newPrinter(format)
+	if err != nil {
+		return err
+	}
+	return p.Print(d.Out, v)
+}
@@ -1,51 +1,511 @@
 package main
 
 import (
+	"bytes"
+	"context"
+	"errors"
 	"fmt"
+	"io/ioutil"
 	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
 
 	"github.com/spf13/cobra"
-	"github.com/spf13/viper"
+	"gopkg.in/yaml.v3"
 )
 
-var (
-	Email    string
-	Password string
-	Address  string
-)
-
-func init() {
-	adrs := os.Getenv("BOXEE_ADDRESS")
-	if adrs == "" {
-		return
-	}
-	Address = adrs
+// initOptions are the options of boxee init
+type initOptions struct {
+	cmdDeps
+	Email   string
+	Address string
+	// Global writes the user config instead of .box-ee.yaml
+	Global bool
+}
 
+func newInitOptions(deps cmdDeps) *initOptions {
+	return &initOptions{cmdDeps: deps, Address: "https://api.box-ee.com"}
 }
 
-func getInitCommand() *cobra.Command {
+func (o *initOptions) Run(ctx context.Context) error {
+	path := o.state.env.workPath(configFile)
+	if o.Global {
+		path = o.state.userConfigPath()
+		if path == "" {
+			return errors.New("unable to find the user config directory. Set XDG_CONFIG_HOME")
+		}
+	}
+	fmt.Fprintln(o.Out, "running init config")
+	return editConfigFileAt(path, func(settings map[string]interface{}) error {
+		settings["email"] = o.Email
+		settings["address"] = o.Address
+		return nil
+	})
+}
 
+func getInitCommand(deps cmdDeps) *cobra.Command {
+	o := newInitOptions(deps)
 	initCommand := &cobra.Command{
 		Use:   "init",
 		Short: "init boxee config in current directory",
 		Long: `
-			init creates a config file is it does not exist already. When creating a config file, passing certain required flags will generate a box-ee.yaml
+			init creates a .box-ee.yaml config file in the current directory with the email and address passed.
+			Pass --global to write the user config in $XDG_CONFIG_HOME/boxee/config.yaml instead
 			`,
 		RunE: func(cmd *cobra.Command, args []string) error {
-			fmt.Println("running init config")
-			//config file does not exist so create one with current flags set
-			setUpViper()
-			return viper.WriteConfig()
-
+			return o.Run(cmd.Context())
 		},
 	}
-	initCommand.Flags().StringVarP(&Email, "email", "e", "", "email used to register")
-	initCommand.Flags().StringVarP(&Address, "address", "a", "https://api.box-ee.com", "box-ee server")
+	initCommand.Flags().StringVarP(&o.Email, "email", "e", "", "email used to register")
+	initCommand.Flags().StringVarP(&o.Address, "address", "a", o.Address, "box-ee server")
+	initCommand.Flags().BoolVarP(&o.Global, "global", "g", false, "write the user config instead of the current directory")
 
-	//make email and password required
+	//make email required
 	initCommand.MarkFlagRequired("email")
-	//bind viper to the flags passed in
-	viper.BindPFlag("email", initCommand.Flags().Lookup("email"))
-	viper.BindPFlag("address", initCommand.Flags().Lookup("address"))
 	return initCommand
 }
+
+func getConfigCmd(deps cmdDeps) *cobra.Command {
+	//config root command. Hang all sub commands related to settings off of this one
+	configCmd := &cobra.Command{
+		Use:   "config",
+		Short: "config actions command",
+		Long: `
+			The root command for settings. Contexts hold the address, email and credential reference of one
+			account on one server. Possible subcommands include get/set/unset/view/edit/validate and
+			get-contexts/set-context/use-context/delete-context`,
+	}
+
+	configCmd.AddCommand(configGet(deps))
+	configCmd.AddCommand(configSet(deps))
+	configCmd.AddCommand(configUnset(deps))
+	configCmd.AddCommand(configView(deps))
+	configCmd.AddCommand(configEdit(deps))
+	configCmd.AddCommand(configValidate(deps))
+	configCmd.AddCommand(configGetContexts(deps))
+	configCmd.AddCommand(configSetContext(deps))
+	configCmd.AddCommand(configUseContext(deps))
+	configCmd.AddCommand(configDeleteContext(deps))
+	return configCmd
+}
+
+// settingOrigin is a row of boxee config view --show-origin
+type settingOrigin struct {
+	Key    string `json:"key"`
+	Value  string `json:"value"`
+	Source string `json:"source"`
+	Origin string `json:"origin"`
+}
+
+// configViewOptions are the options of boxee config view
+type configViewOptions struct {
+	cmdDeps
+	ShowOrigin bool
+	// Format is --output when it was passed. The default is yaml for the
+	// settings and table with ShowOrigin
+	Format string
+}
+
+func newConfigViewOptions(deps cmdDeps) *configViewOptions {
+	return &configViewOptions{cmdDeps: deps}
+}
+
+func (o *configViewOptions) Run(ctx context.Context) error {
+	if err := o.state.readConfig(); err != nil {
+		return err
+	}
+	merged := maskSettings(o.state.config.merged, "")
+	if !o.ShowOrigin {
+		return o.printAs(orDefault(o.Format, "yaml"), merged)
+	}
+
+	flat := map[string]interface{}{}
+	flatten("", merged, flat)
+	var keys []string
+	for k := range flat {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	rows := []settingOrigin{}
+	for _, k := range keys {
+		l, _ := o.state.config.origin(k)
+		rows = append(rows, settingOrigin{
+			Key:    k,
+			Value:  fmt.Sprint(flat[k]),
+			Source: l.Source,
+			Origin: l.Origin,
+		})
+	}
+	return o.printAs(orDefault(o.Format, "table"), rows)
+}
+
+func configView(deps cmdDeps) *cobra.Command {
+	o := newConfigViewOptions(deps)
+	configViewCmd := &cobra.Command{
+		Use:   "view",
+		Short: "show the merged config",
+		Long: `
+		show the config merged from every layer. From lowest to highest precedence the layers are
+		/etc/boxee/config.yaml, $XDG_CONFIG_HOME/boxee/config.yaml, the nearest .box-ee.yaml walking up
+		from the current directory, BOXEE_* environment variables and flags. --show-origin reports the
+		layer each value came from. Secrets are masked`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			o.Format = passedFormat(cmd)
+			return o.Run(cmd.Context())
+		},
+	}
+	configViewCmd.Flags().BoolVarP(&o.ShowOrigin, "show-origin", "", false, "show where each value comes from")
+	return configViewCmd
+}
+
+// passedFormat returns the --output format when it was passed and "" otherwise,
+// for commands whose default format differs from json
+func passedFormat(cmd *cobra.Command) string {
+	if !cmd.Flags().Changed("output") {
+		return ""
+	}
+	output, _ := cmd.Flags().GetString("output")
+	return output
+}
+
+// orDefault returns format, or def when format is empty
+func orDefault(format, def string) string {
+	if format == "" {
+		return def
+	}
+	return format
+}
+
+// configTargetPath is the file set, unset and edit change
+func (s *runState) configTargetPath(global bool) (string, error) {
+	if !global {
+		return s.configWritePath(), nil
+	}
+	path := s.userConfigPath()
+	if path == "" {
+		return "", errors.New("unable to find the user config directory. Set XDG_CONFIG_HOME")
+	}
+	return path, nil
+}
+
+// configGetOptions are the options of boxee config get
+type configGetOptions struct {
+	cmdDeps
+	// Key is dotted, as in contexts.prod.address
+	Key string
+}
+
+func newConfigGetOptions(deps cmdDeps) *configGetOptions {
+	return &configGetOptions{cmdDeps: deps}
+}
+
+func (o *configGetOptions) Run(ctx context.Context) error {
+	schemaKey, path, ok := lookupConfigKey(o.Key)
+	if !ok {
+		return fmt.Errorf("%w: %v", ErrorUnknownConfigKey, o.Key)
+	}
+	if err := o.state.readConfig(); err != nil {
+		return err
+	}
+	value, ok := getPath(o.state.config.merged, path)
+	if !ok {
+		return fmt.Errorf("%v is not set", o.Key)
+	}
+	if nested, isMap := value.(map[string]interface{}); isMap {
+		return o.print(maskSettings(nested, strings.Join(path, ".")))
+	}
+	if schemaKey.Sensitive {
+		value = maskedSecret
+	}
+	fmt.Fprintln(o.Out, value)
+	return nil
+}
+
+func configGet(deps cmdDeps) *cobra.Command {
+	o := newConfigGetOptions(deps)
+	return &cobra.Command{
+		Use:   "get KEY",
+		Short: "print the effective value of a setting",
+		Long: `
+		print the value of a setting after every layer is merged. Nested keys are dotted, as in
+		contexts.prod.address`,
+		Args: cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			o.Key = args[0]
+			return o.Run(cmd.Context())
+		},
+	}
+}
+
+// configSetOptions are the options of boxee config set
+type configSetOptions struct {
+	cmdDeps
+	Key   string
+	Value string
+	// Global writes the user config instead of the nearest .box-ee.yaml
+	Global bool
+}
+
+func newConfigSetOptions(deps cmdDeps) *configSetOptions {
+	return &configSetOptions{cmdDeps: deps}
+}
+
+func (o *configSetOptions) Run(ctx context.Context) error {
+	value, err := parseConfigValue(o.Key, o.Value)
+	if err != nil {
+		return err
+	}
+	_, path, _ := lookupConfigKey(o.Key)
+	target, err := o.state.configTargetPath(o.Global)
+	if err != nil {
+		return err
+	}
+	return editConfigFileAt(target, func(settings map[string]interface{}) error {
+		setPath(settings, path, value)
+		fmt.Fprintf(o.ErrOut, "%v saved to %v\n", o.Key, target)
+		return nil
+	})
+}
+
+func configSet(deps cmdDeps) *cobra.Command {
+	o := newConfigSetOptions(deps)
+	setCmd := &cobra.Command{
+		Use:   "set KEY VALUE",
+		Short: "change a setting",
+		Long: `
+		validate and save a setting to the nearest .box-ee.yaml, or the user config when there is none.
+		Pass --global to always write the user config`,
+		Args: cobra.ExactArgs(2),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			o.Key, o.Value = args[0], args[1]
+			return o.Run(cmd.Context())
+		},
+	}
+	setCmd.Flags().BoolVarP(&o.Global, "global", "g", false, "write the user config")
+	return setCmd
+}
+
+// configUnsetOptions are the options of boxee config unset
+type configUnsetOptions struct {
+	cmdDeps
+	Key string
+	// Global changes the user config instead of the nearest .box-ee.yaml
+	Global bool
+}
+
+func newConfigUnsetOptions(deps cmdDeps) *configUnsetOptions {
+	return &configUnsetOptions{cmdDeps: deps}
+}
+
+func (o *configUnsetOptions) Run(ctx context.Context) error {
+	//unknown keys can still be removed, which is how problems reported
+	//by boxee config validate are fixed
+	_, path, ok := lookupConfigKey(o.Key)
+	if !ok {
+		path = strings.Split(o.Key, ".")
+	}
+	target, err := o.state.configTargetPath(o.Global)
+	if err != nil {
+		return err
+	}
+	return editConfigFileAt(target, func(settings map[string]interface{}) error {
+		if !unsetPath(settings, path) {
+			return fmt.Errorf("%v is not set in %v", o.Key, target)
+		}
+		fmt.Fprintf(o.ErrOut, "%v removed from %v\n", o.Key, target)
+		return nil
+	})
+}
+
+func configUnset(deps cmdDeps) *cobra.Command {
+	o := newConfigUnsetOptions(deps)
+	unsetCmd := &cobra.Command{
+		Use:   "unset KEY",
+		Short: "remove a setting",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			o.Key = args[0]
+			return o.Run(cmd.Context())
+		},
+	}
+	unsetCmd.Flags().BoolVarP(&o.Global, "global", "g", false, "change the user config")
+	return unsetCmd
+}
+
+// configEditOptions are the options of boxee config edit
+type configEditOptions struct {
+	cmdDeps
+	// Global edits the user config instead of the nearest .box-ee.yaml
+	Global bool
+	// Format is --output when it was passed, problems are a table otherwise
+	Format string
+}
+
+func newConfigEditOptions(deps cmdDeps) *configEditOptions {
+	return &configEditOptions{cmdDeps: deps}
+}
+
+func (o *configEditOptions) Run(ctx context.Context) error {
+	target, err := o.state.configTargetPath(o.Global)
+	if err != nil {
+		return err
+	}
+	original, err := ioutil.ReadFile(target)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	tmp, err := ioutil.TempFile("", "boxee-*.yaml")
+	if err != nil {
+		return err
+	}
+	if _, err := tmp.Write(original); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+
+	editor := strings.Fields(os.Getenv("VISUAL"))
+	if len(editor) == 0 {
+		editor = strings.Fields(os.Getenv("EDITOR"))
+	}
+	if len(editor) == 0 {
+		editor = []string{"vi"}
+	}
+	run := exec.Command(editor[0], append(editor[1:], tmp.Name())...)
+	//the editor gets the terminal itself rather than the tracked stdin of deps
+	run.Stdin, run.Stdout, run.Stderr = o.state.env.Stdin, o.Out, o.ErrOut
+	if err := run.Run(); err != nil {
+		return fmt.Errorf("editor failed, your edits are in %v: %w", tmp.Name(), err)
+	}
+
+	edited, err := ioutil.ReadFile(tmp.Name())
+	if err != nil {
+		return err
+	}
+	if bytes.Equal(edited, original) {
+		os.Remove(tmp.Name())
+		fmt.Fprintln(o.ErrOut, "no changes made")
+		return nil
+	}
+	settings := map[string]interface{}{}
+	if err := yaml.Unmarshal(edited, &settings); err != nil {
+		return fmt.Errorf("invalid yaml, config not saved. Your edits are in %v: %w", tmp.Name(), err)
+	}
+	if problems := validateSettings(target, settings); len(problems) > 0 {
+		o.printAs(orDefault(o.Format, "table"), problems)
+		return fmt.Errorf("config not saved. Your edits are in %v", tmp.Name())
+	}
+	if err := os.MkdirAll(filepath.Dir(target), 0700); err != nil {
+		return err
+	}
+	if err := ioutil.WriteFile(target, edited, 0600); err != nil {
+		return err
+	}
+	os.Remove(tmp.Name())
+	fmt.Fprintf(o.ErrOut, "%v saved\n", target)
+	return nil
+}
+
+func configEdit(deps cmdDeps) *cobra.Command {
+	o := newConfigEditOptions(deps)
+	editCmd := &cobra.Command{
+		Use:   "edit",
+		Short: "edit the config file in $EDITOR",
+		Long: `
+		open the config file in $VISUAL or $EDITOR (vi by default). The file is only saved when it is
+		valid yaml and passes boxee config validate, otherwise the edited copy is kept for another try`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			o.Format = passedFormat(cmd)
+			return o.Run(cmd.Context())
+		},
+	}
+	editCmd.Flags().BoolVarP(&o.Global, "global", "g", false, "edit the user config")
+	return editCmd
+}
+
+// configValidateOptions are the options of boxee config validate
+type configValidateOptions struct {
+	cmdDeps
+	// Format is --output when it was passed, problems are a table otherwise
+	Format string
+}
+
+func newConfigValidateOptions(deps cmdDeps) *configValidateOptions {
+	return &configValidateOptions{cmdDeps: deps}
+}
+
+func (o *configValidateOptions) Run(ctx context.Context) error {
+	problems := []configProblem{}
+	for _, l := range o.state.configFileLayers() {
+		settings, found, err := readYAMLFile(l.Origin)
+		if err != nil {
+			problems = append(problems, configProblem{File: l.Origin, Problem: err.Error()})
+			continue
+		}
+		if !found {
+			continue
+		}
+		problems = append(problems, validateSettings(l.Origin, settings)...)
+		problems = append(problems, validateFilePermissions(l.Origin, settings)...)
+	}
+	for _, l := range o.state.overrideLayers() {
+		problems = append(problems, validateSettings(l.Origin, l.Settings)...)
+	}
+	if len(problems) == 0 {
+		fmt.Fprintln(o.ErrOut, "config is valid")
+		return nil
+	}
+	if err := o.printAs(orDefault(o.Format, "table"), problems); err != nil {
+		return err
+	}
+	return fmt.Errorf("%d config problems found", len(problems))
+}
+
+func configValidate(deps cmdDeps) *cobra.Command {
+	o := newConfigValidateOptions(deps)
+	return &cobra.Command{
+		Use:   "validate",
+		Short: "check every config layer",
+		Long: `
+		check every config file and BOXEE_* environment variable for unknown keys and malformed values,
+		and every config file for unsafe permissions`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			o.Format = passedFormat(cmd)
+			return o.Run(cmd.Context())
+		},
+	}
+}
+
+// editConfigFile applies edit to the raw settings of the config file commands
+// write to and saves it, creating the file when needed. Use it to remove or
+// nest keys, which viper cannot do
+func (s *runState) editConfigFile(edit func(settings map[string]interface{}) error) error {
+	return editConfigFileAt(s.configWritePath(), edit)
+}
+
+func editConfigFileAt(path string, edit func(settings map[string]interface{}) error) error {
+	settings, _, err := readYAMLFile(path)
+	if err != nil {
+		return err
+	}
+	if settings == nil {
+		settings = map[string]interface{}{}
+	}
+	if err := edit(settings); err != nil {
+		return err
+	}
+	var out bytes.Buffer
+	enc := yaml.NewEncoder(&out)
+	enc.SetIndent(2)
+	if err := enc.Encode(settings); err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return err
+	}
+	return ioutil.WriteFile(path, out.Bytes(), 0600)
+}
@@ -0,0 +1,137 @@
+package main
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestConfigCommands(t *testing.T) {
+	contexts := loggedOutConfig + `current_context: staging
+contexts:
+  staging:
+    address: http://staging.boxee.test
+    email: staging@example.com
+  prod:
+    address: http://boxee.test
+    email: qa@example.com
+    credential_ref: prod
+    retry:
+      max_retries: 1
+`
+	runCLICases(t, []cliCase{
+		{name: "init", args: []string{"init", "--email", "new@example.com"}, noConfig: true, show: []string{configFile}},
+		{name: "init/address", args: []string{"init", "--email", "new@example.com", "--address", testAddress}, noConfig: true, show: []string{configFile}},
+		{name: "init/global", args: []string{"init", "--global", "--email", "new@example.com"}, noConfig: true},
+		{name: "init/no_email", args: []string{"init"}, noConfig: true},
+		{name: "config/get", args: []string{"config", "get", "address"}},
+		{name: "config/get_nested", args: []string{"config", "get", "retry.base_delay"}},
+		{name: "config/get_unknown", args: []string{"config", "get", "nope"}},
+		{name: "config/get_env_override", args: []string{"config", "get", "email"}, env: map[string]string{"BOXEE_EMAIL": "env@example.com"}},
+		{name: "config/set", args: []string{"config", "set", "rate_limit.rps", "2.5"}, show: []string{configFile}},
+		{name: "config/set_invalid_address", args: []string{"config", "set", "address", "ftp://boxee.test"}},
+		{name: "config/set_invalid_number", args: []string{"config", "set", "retry.max_retries", "many"}},
+		{name: "config/set_unknown", args: []string{"config", "set", "colour", "blue"}},
+		{name: "config/unset", args: []string{"config", "unset", "retry.base_delay"}, show: []string{configFile}},
+		{name: "config/view", args: []string{"config", "view"}},
+		{name: "config/view_headers", args: []string{"config", "view", "-o", "yaml"}, config: loggedOutConfig + "headers:\n  Authorization: Bearer sk_live_0123456789\n"},
+		{name: "config/get_header", args: []string{"config", "get", "headers.authorization"}, config: loggedOutConfig + "headers:\n  Authorization: Bearer sk_live_0123456789\n"},
+		{name: "config/set_header_case", args: []string{"config", "set", "headers.authorization", "Bearer sk_live_new"}, config: loggedOutConfig + "headers:\n  Authorization: Bearer sk_live_0123456789\n", show: []string{configFile}},
+		{name: "config/unset_header_case", args: []string{"config", "unset", "headers.authorization"}, config: loggedOutConfig + "headers:\n  Authorization: Bearer sk_live_0123456789\n", show: []string{configFile}},
+		{name: "config/view_show_origin", args: []string{"config", "view", "--show-origin"}, env: map[string]string{"BOXEE_CREDENTIAL_STORE": "plaintext"}},
+		{name: "config/validate", args: []string{"config", "validate"}},
+		{name: "config/validate_problems", args: []string{"config", "validate", "-o", "yaml"}, config: strings.Replace(loggedOutConfig, "qa@example.com", "not-an-email", 1) + "colour: blue\n"},
+		{
+			name: "config/edit",
+			args: []string{"config", "edit"},
+			env:  map[string]string{"EDITOR": "sed -i s/qa@example.com/new@example.com/"},
+			show: []string{configFile},
+		},
+		{
+			name: "config/edit_invalid",
+			args: []string{"config", "edit", "-o", "yaml"},
+			env:  map[string]string{"EDITOR": "sed -i s|http://boxee.test|ftp://boxee.test|"},
+			show: []string{configFile},
+		},
+		{name: "config/edit_unchanged", args: []string{"config", "edit"}, env: map[string]string{"EDITOR": "true"}},
+		{name: "config/get_contexts", args: []string{"config", "get-contexts", "-o", "table"}, config: contexts},
+		{name: "config/get_contexts_flag", args: []string{"config", "get-contexts", "-o", "table", "--context", "prod"}, config: contexts},
+		{name: "config/get_contexts_mixed_case", args: []string{"config", "get-contexts", "-o", "table", "--context", "Prod"}, config: strings.Replace(contexts, "  prod:", "  Prod:", 1)},
+		{name: "config/mixed_case_email", args: []string{"whoami", "-o", "yaml"}, config: strings.ReplaceAll(loggedInConfig, "qa@example.com", "QA@Example.com")},
+		{name: "config/set_context", args: []string{"config", "set-context", "dev", "--address", "http://127.0.0.1:8080", "--email", "dev@box-ee.local"}, config: contexts, show: []string{configFile}},
+		{name: "config/set_context_invalid", args: []string{"config", "set-context", "dev", "--address", "nope"}, config: contexts},
+		{name: "config/set_context_invalid_email", args: []string{"config", "set-context", "staging", "--email", "qa.example.com"}, config: contexts, show: []string{configFile}},
+		{name: "config/whoami_broken_config", args: []string{"whoami"}, config: "address: [http://boxee.test\n"},
+		{name: "config/use_context", args: []string{"config", "use-context", "prod"}, config: contexts, show: []string{configFile}},
+		{name: "config/use_context_missing", args: []string{"config", "use-context", "nope"}, config: contexts},
+		{name: "config/delete_context", args: []string{"config", "delete-context", "staging"}, config: contexts, show: []string{configFile}},
+		{
+			name:   "config/context_login",
+			args:   []string{"whoami", "--context", "prod"},
+			config: contexts,
+			before: [][]string{{"login", "--context", "prod", "--password", "Correct-Horse-9"}},
+			show:   []string{configFile},
+		},
+	})
+}
+
+func TestCredentialsCommands(t *testing.T) {
+	legacy := `address: http://boxee.test
+email: qa@example.com
+session_token: sess_qa
+client_key: ck_locker
+`
+	fileStoreConfig := `address: http://boxee.test
+email: qa@example.com
+credential_store: file
+`
+	oldFile := legacyCredentialFileContent(t, "qa@example.com@http://boxee.test/session_token", "sess_qa")
+	runCLICases(t, []cliCase{
+		{name: "credentials/legacy_warning", args: []string{"whoami"}, config: legacy, env: map[string]string{"BOXEE_CREDENTIAL_STORE": "file", passphraseEnvName: "pass"}},
+		{name: "credentials/migrate", args: []string{"credentials", "migrate", "--to", "file"}, config: legacy, env: map[string]string{passphraseEnvName: "pass"}, show: []string{configFile}},
+		{
+			name:   "credentials/migrate_then_pin",
+			args:   []string{"pin", "validate", "111111"},
+			config: legacy,
+			env:    map[string]string{passphraseEnvName: "pass"},
+			before: [][]string{{"credentials", "migrate", "--to", "file"}},
+		},
+		{name: "credentials/migrate_plaintext", args: []string{"credentials", "migrate", "--to", "file"}, env: map[string]string{passphraseEnvName: "pass"}, show: []string{configFile}},
+		{
+			name:   "credentials/migrate_plaintext_then_whoami",
+			args:   []string{"whoami", "-o", "yaml"},
+			env:    map[string]string{passphraseEnvName: "pass"},
+			before: [][]string{{"credentials", "migrate", "--to", "file"}},
+		},
+		{name: "credentials/migrate_no_passphrase", args: []string{"credentials", "migrate", "--to", "file"}, config: legacy, show: []string{configFile}},
+		{name: "credentials/migrate_to_plaintext", args: []string{"credentials", "migrate", "--to", "plaintext"}, config: legacy},
+		//commands without a session never open the credential store
+		{name: "credentials/config_view_no_lookup", args: []string{"config", "view"}, config: legacy, env: map[string]string{"BOXEE_CREDENTIAL_STORE": "file"}},
+		{
+			name:   "credentials/legacy_file_moved",
+			args:   []string{"whoami", "-o", "yaml"},
+			config: fileStoreConfig,
+			env:    map[string]string{passphraseEnvName: "pass"},
+			files:  map[string]string{legacyCredentialFile: oldFile},
+			show:   []string{legacyCredentialFile},
+		},
+		{name: "credentials/version_no_lookup", args: []string{"version"}, config: legacy, env: map[string]string{"BOXEE_CREDENTIAL_STORE": "file"}},
+	})
+}
+
+// legacyCredentialFileContent returns a .box-ee.credentials written by an
+// older version, encrypted with the passphrase "pass"
+func legacyCredentialFileContent(t *testing.T, name, value string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), legacyCredentialFile)
+	store := &fileStore{path: path, passphrase: []byte("pass")}
+	if err := store.Set(name, value); err != nil {
+		t.Fatal(err)
+	}
+	raw, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(raw)
+}
@@ -0,0 +1,273 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"runtime"
+	"sort"
+
+	"github.com/spf13/viper"
+	"gopkg.in/yaml.v3"
+)
+
+// config layers from lowest to highest precedence
+const (
+	layerSystem  string = "system"
+	layerUser    string = "user"
+	layerProject string = "project"
+	layerEnv     string = "env"
+	layerFlag    string = "flag"
+)
+
+// envConfigKeys maps the BOXEE_* environment variables onto config keys
+var envConfigKeys = map[string]string{
+	"BOXEE_ADDRESS":          "address",
+	"BOXEE_EMAIL":            "email",
+	"BOXEE_CONTEXT":          "current_context",
+	"BOXEE_CREDENTIAL_STORE": "credential_store",
+	"BOXEE_CREDENTIAL_FILE":  "credential_file",
+	"BOXEE_CLIENT_KEY":       "client_key",
+}
+
+// systemConfigPath can be moved by packagers, it is not read on windows
+var systemConfigPath = "/etc/boxee/config.yaml"
+
+// configLayer is one source of settings
+type configLayer struct {
+	Source   string
+	Origin   string
+	Settings map[string]interface{}
+}
+
+// layeredConfig is the result of merging every config layer
+type layeredConfig struct {
+	layers []configLayer
+	merged map[string]interface{}
+}
+
+// userConfigDir returns $XDG_CONFIG_HOME/boxee, defaulting to ~/.config/boxee
+func (s *runState) userConfigDir() string {
+	if s.env.ConfigDir != "" {
+		return s.env.ConfigDir
+	}
+	if dir := os.Getenv("XDG_CONFIG_HOME"); dir != "" {
+		return filepath.Join(dir, "boxee")
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(home, ".config", "boxee")
+}
+
+func (s *runState) userConfigPath() string {
+	dir := s.userConfigDir()
+	if dir == "" {
+		return ""
+	}
+	return filepath.Join(dir, "config.yaml")
+}
+
+// findProjectConfig walks up from the working directory to the nearest .box-ee.yaml
+func (s *runState) findProjectConfig() string {
+	dir := s.env.WorkDir
+	if dir == "" {
+		wd, err := os.Getwd()
+		if err != nil {
+			return ""
+		}
+		dir = wd
+	}
+	for {
+		candidate := filepath.Join(dir, configFile)
+		if info, err := os.Stat(candidate); err == nil && !info.IsDir() {
+			return candidate
+		}
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return ""
+		}
+		dir = parent
+	}
+}
+
+// configWritePath is the file commands persist settings to: the nearest
+// project config when there is one and the user config otherwise
+func (s *runState) configWritePath() string {
+	if p := s.findProjectConfig(); p != "" {
+		return p
+	}
+	if p := s.userConfigPath(); p != "" {
+		return p
+	}
+	return s.env.workPath(configFile)
+}
+
+func readYAMLFile(path string) (map[string]interface{}, bool, error) {
+	raw, err := ioutil.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, false, nil
+	}
+	if err != nil {
+		return nil, false, err
+	}
+	settings := map[string]interface{}{}
+	if err := yaml.Unmarshal(raw, &settings); err != nil {
+		return nil, true, fmt.Errorf("invalid yaml in %v: %w", path, err)
+	}
+	return settings, true, nil
+}
+
+// loadLayeredConfig reads the system, user and project files and the env and
+// flag overrides. Later layers win
+func (s *runState) loadLayeredConfig() (*layeredConfig, error) {
+	cfg := &layeredConfig{merged: map[string]interface{}{}}
+	for _, l := range s.configFileLayers() {
+		settings, found, err := readYAMLFile(l.Origin)
+		if err != nil {
+			return nil, err
+		}
+		if !found {
+			continue
+		}
+		l.Settings = settings
+		cfg.add(l)
+	}
+	for _, l := range s.overrideLayers() {
+		cfg.add(l)
+	}
+	return cfg, nil
+}
+
+// configFileLayers lists the config files that may exist, without reading them
+func (s *runState) configFileLayers() []configLayer {
+	var files []configLayer
+	if runtime.GOOS != "windows" {
+		files = append(files, configLayer{Source: layerSystem, Origin: systemConfigPath})
+	}
+	if p := s.userConfigPath(); p != "" {
+		files = append(files, configLayer{Source: layerUser, Origin: p})
+	}
+	if p := s.findProjectConfig(); p != "" {
+		files = append(files, configLayer{Source: layerProject, Origin: p})
+	}
+	return files
+}
+
+// overrideLayers returns the settings given through the environment and flags
+func (s *runState) overrideLayers() []configLayer {
+	var layers []configLayer
+	var envNames []string
+	for name := range envConfigKeys {
+		envNames = append(envNames, name)
+	}
+	sort.Strings(envNames)
+	for _, name := range envNames {
+		if v := os.Getenv(name); v != "" {
+			layers = append(layers, configLayer{Source: layerEnv, Origin: name, Settings: map[string]interface{}{envConfigKeys[name]: v}})
+		}
+	}
+
+	if s.flags.Address != "" {
+		layers = append(layers, configLayer{Source: layerFlag, Origin: "--address", Settings: map[string]interface{}{"address": s.flags.Address}})
+	}
+	if s.flags.Context != "" {
+		layers = append(layers, configLayer{Source: layerFlag, Origin: "--context", Settings: map[string]interface{}{"current_context": s.flags.Context}})
+	}
+	return append(layers, s.flags.layers...)
+}
+
+func (c *layeredConfig) add(l configLayer) {
+	c.layers = append(c.layers, l)
+	deepMerge(c.merged, l.Settings)
+}
+
+// hasFile reports whether any config file was found
+func (c *layeredConfig) hasFile() bool {
+	for _, l := range c.layers {
+		if l.Source == layerSystem || l.Source == layerUser || l.Source == layerProject {
+			return true
+		}
+	}
+	return false
+}
+
+// origin returns the layer that supplied the final value of a flattened key
+func (c *layeredConfig) origin(key string) (configLayer, bool) {
+	var found configLayer
+	ok := false
+	for _, l := range c.layers {
+		flat := map[string]interface{}{}
+		flatten("", l.Settings, flat)
+		if _, has := flat[key]; has {
+			found, ok = l, true
+		}
+	}
+	return found, ok
+}
+
+// overridden reports whether key was set by the environment or a flag, which
+// take precedence over values coming from a context
+func (c *layeredConfig) overridden(key string) bool {
+	l, ok := c.origin(key)
+	return ok && (l.Source == layerEnv || l.Source == layerFlag)
+}
+
+// deepMerge copies src into dst, merging nested maps
+func deepMerge(dst, src map[string]interface{}) {
+	for k, v := range src {
+		srcMap, srcIsMap := v.(map[string]interface{})
+		dstMap, dstIsMap := dst[k].(map[string]interface{})
+		if srcIsMap && dstIsMap {
+			deepMerge(dstMap, srcMap)
+			continue
+		}
+		if srcIsMap {
+			copied := map[string]interface{}{}
+			deepMerge(copied, srcMap)
+			v = copied
+		}
+		dst[k] = v
+	}
+}
+
+// flatten turns nested maps into dotted keys
+func flatten(prefix string, m map[string]interface{}, out map[string]interface{}) {
+	for k, v := range m {
+		key := k
+		if prefix != "" {
+			key = prefix + "." + k
+		}
+		if nested, ok := v.(map[string]interface{}); ok && len(nested) > 0 {
+			flatten(key, nested, out)
+			continue
+		}
+		out[key] = v
+	}
+}
+
+// readConfig loads every config layer into the viper of the run. It fails
+// when no config file exists and no address was given through the environment
+// or a flag, unless a cassette is replayed
+func (s *runState) readConfig() error {
+	cfg, err := s.loadLayeredConfig()
+	if err != nil {
+		return err
+	}
+	s.config = cfg
+	s.viper = viper.New()
+	//viper lowercases the keys of the map it is given in place, hand it a
+	//copy so context names and credential names keep their case
+	copied := map[string]interface{}{}
+	deepMerge(copied, cfg.merged)
+	if err := s.viper.MergeConfigMap(copied); err != nil {
+		return err
+	}
+	if !cfg.hasFile() && !cfg.overridden("address") && s.flags.Replay == "" {
+		return ErrorConfigNotFound
+	}
+	return nil
+}
@@ -0,0 +1,322 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/mail"
+	"net/url"
+	"os"
+	"runtime"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var ErrorUnknownConfigKey = errors.New("unknown config key. Run boxee config view to see valid keys")
+
+// configType is the type a setting is parsed into before it is saved
+type configType int
+
+const (
+	configString configType = iota
+	configInt
+	configFloat
+	configBool
+	configDuration
+)
+
+// configKey describes a setting the config files may hold. A * in Name
+// matches a single user chosen segment such as a context name
+type configKey struct {
+	Name        string
+	Type        configType
+	Description string
+	Sensitive   bool
+	Validate    func(value string) error
+}
+
+// configSchema lists every key boxee understands. Transport settings may also
+// be set per context
+var configSchema = append(baseSchema, withContextKeys(transportSchema)...)
+
+var baseSchema = []configKey{
+	{Name: "address", Description: "box-ee server url", Validate: validateAddress},
+	{Name: "email", Description: "account email", Validate: validateEmail},
+	{Name: "current_context", Description: "context used when --context is not passed"},
+	{Name: "credential_store", Description: "keyring, file or plaintext", Validate: oneOf(storeKeyring, storeFile, storePlaintext)},
+	{Name: "credential_file", Description: "path of the encrypted credential file"},
+	{Name: "contexts.*.address", Description: "box-ee server url of a context", Validate: validateAddress},
+	{Name: "contexts.*.email", Description: "account email of a context", Validate: validateEmail},
+	{Name: "contexts.*.credential_ref", Description: "name the secrets of a context are stored under"},
+	{Name: "credentials.*", Description: "secret kept by the plaintext credential store", Sensitive: true},
+	{Name: "session_token", Description: "legacy plaintext session token, run boxee credentials migrate", Sensitive: true},
+	{Name: "client_key", Description: "device client key from BOXEE_CLIENT_KEY, in a config file a legacy plaintext key, run boxee credentials migrate", Sensitive: true},
+}
+
+// withContextKeys returns keys followed by their copies under contexts.*
+func withContextKeys(keys []configKey) []configKey {
+	all := append([]configKey{}, keys...)
+	for _, k := range keys {
+		k.Name = "contexts.*." + k.Name
+		all = append(all, k)
+	}
+	return all
+}
+
+// lookupConfigKey finds the schema entry for a dotted key and returns the path
+// of map keys it addresses. The * segment may itself contain dots
+func lookupConfigKey(key string) (configKey, []string, bool) {
+	for _, k := range configSchema {
+		star := strings.Index(k.Name, "*")
+		if star < 0 {
+			if k.Name == key {
+				return k, strings.Split(key, "."), true
+			}
+			continue
+		}
+		prefix, suffix := k.Name[:star], k.Name[star+1:]
+		if !strings.HasPrefix(key, prefix) || !strings.HasSuffix(key, suffix) || len(key) <= len(prefix)+len(suffix) {
+			continue
+		}
+		middle := key[len(prefix) : len(key)-len(suffix)]
+		var path []string
+		if prefix != "" {
+			path = append(path, strings.Split(strings.TrimSuffix(prefix, "."), ".")...)
+		}
+		path = append(path, middle)
+		if suffix != "" {
+			path = append(path, strings.Split(strings.TrimPrefix(suffix, "."), ".")...)
+		}
+		return k, path, true
+	}
+	return configKey{}, nil, false
+}
+
+// parseConfigValue checks key and value against the schema and returns the
+// value converted to the type of the key
+func parseConfigValue(key, value string) (interface{}, error) {
+	k, _, ok := lookupConfigKey(key)
+	if !ok {
+		return nil, fmt.Errorf("%w: %v", ErrorUnknownConfigKey, key)
+	}
+	var parsed interface{} = value
+	var err error
+	switch k.Type {
+	case configInt:
+		parsed, err = strconv.Atoi(value)
+	case configFloat:
+		parsed, err = strconv.ParseFloat(value, 64)
+	case configBool:
+		parsed, err = strconv.ParseBool(value)
+	case configDuration:
+		//durations are kept as strings such as 30s so the file stays readable
+		_, err = time.ParseDuration(value)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("invalid value for %v: %w", key, err)
+	}
+	if k.Validate != nil {
+		if err := k.Validate(value); err != nil {
+			return nil, fmt.Errorf("invalid value for %v: %w", key, err)
+		}
+	}
+	return parsed, nil
+}
+
+func validateAddress(value string) error {
+	u, err := url.Parse(value)
+	if err != nil {
+		return err
+	}
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return errors.New("address must start with http:// or https://")
+	}
+	if u.Host == "" {
+		return errors.New("address has no host")
+	}
+	return nil
+}
+
+func validateEmail(value string) error {
+	if _, err := mail.ParseAddress(value); err != nil {
+		return errors.New("not a valid email address")
+	}
+	return nil
+}
+
+func nonNegative(value string) error {
+	if f, err := strconv.ParseFloat(value, 64); err == nil && f < 0 {
+		return errors.New("must not be negative")
+	}
+	return nil
+}
+
+func oneOf(values ...string) func(string) error {
+	return func(value string) error {
+		for _, v := range values {
+			if v == value {
+				return nil
+			}
+		}
+		return fmt.Errorf("must be one of %v", strings.Join(values, ", "))
+	}
+}
+
+// maskedSecret replaces the whole of a sensitive value, not even its length
+// is shown
+const maskedSecret = "********"
+
+// maskSettings returns a copy of settings with sensitive values masked
+func maskSettings(settings map[string]interface{}, prefix string) map[string]interface{} {
+	masked := map[string]interface{}{}
+	for k, v := range settings {
+		key := k
+		if prefix != "" {
+			key = prefix + "." + k
+		}
+		if nested, ok := v.(map[string]interface{}); ok {
+			masked[k] = maskSettings(nested, key)
+			continue
+		}
+		if schemaKey, _, ok := lookupConfigKey(key); ok && schemaKey.Sensitive {
+			masked[k] = maskedSecret
+			continue
+		}
+		masked[k] = v
+	}
+	return masked
+}
+
+// configProblem is a row of boxee config validate
+type configProblem struct {
+	File    string `json:"file"`
+	Key     string `json:"key,omitempty"`
+	Problem string `json:"problem"`
+}
+
+// validateSettings checks every key of a config file against the schema
+func validateSettings(file string, settings map[string]interface{}) []configProblem {
+	var problems []configProblem
+	flat := map[string]interface{}{}
+	flatten("", settings, flat)
+	var keys []string
+	for k := range flat {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		if flat[k] == nil {
+			continue
+		}
+		switch flat[k].(type) {
+		case map[string]interface{}, []interface{}:
+			if _, _, known := lookupConfigKey(k); known {
+				problems = append(problems, configProblem{File: file, Key: k, Problem: "value must be a single value"})
+				continue
+			}
+		}
+		if _, err := parseConfigValue(k, fmt.Sprint(flat[k])); err != nil {
+			problems = append(problems, configProblem{File: file, Key: k, Problem: err.Error()})
+		}
+	}
+	return problems
+}
+
+// validateFilePermissions reports config files other users can change, or read
+// while they hold secrets
+func validateFilePermissions(file string, settings map[string]interface{}) []configProblem {
+	if runtime.GOOS == "windows" {
+		return nil
+	}
+	info, err := os.Stat(file)
+	if err != nil {
+		return []configProblem{{File: file, Problem: err.Error()}}
+	}
+	var problems []configProblem
+	mode := info.Mode().Perm()
+	if mode&0022 != 0 {
+		problems = append(problems, configProblem{File: file, Problem: fmt.Sprintf("writable by other users (mode %v)", mode)})
+	}
+	if mode&0044 != 0 && holdsSecrets(settings) {
+		problems = append(problems, configProblem{File: file, Problem: fmt.Sprintf("holds secrets but is readable by other users (mode %v). Run chmod 600 or boxee credentials migrate", mode)})
+	}
+	return problems
+}
+
+func holdsSecrets(settings map[string]interface{}) bool {
+	flat := map[string]interface{}{}
+	flatten("", settings, flat)
+	for k := range flat {
+		if schemaKey, _, ok := lookupConfigKey(k); ok && schemaKey.Sensitive {
+			return true
+		}
+	}
+	return false
+}
+
+// setPath sets a nested value, creating intermediate maps
+func setPath(settings map[string]interface{}, path []string, value interface{}) {
+	current := settings
+	for _, p := range path[:len(path)-1] {
+		p = foldKey(current, p)
+		next, ok := current[p].(map[string]interface{})
+		if !ok {
+			next = map[string]interface{}{}
+			current[p] = next
+		}
+		current = next
+	}
+	current[foldKey(current, path[len(path)-1])] = value
+}
+
+// unsetPath removes a nested value and prunes maps left empty. It reports
+// whether the value existed
+func unsetPath(settings map[string]interface{}, path []string) bool {
+	key := foldKey(settings, path[0])
+	if len(path) == 1 {
+		_, ok := settings[key]
+		delete(settings, key)
+		return ok
+	}
+	next, ok := settings[key].(map[string]interface{})
+	if !ok {
+		return false
+	}
+	removed := unsetPath(next, path[1:])
+	if len(next) == 0 {
+		delete(settings, key)
+	}
+	return removed
+}
+
+// getPath returns a nested value
+func getPath(settings map[string]interface{}, path []string) (interface{}, bool) {
+	var current interface{} = settings
+	for _, p := range path {
+		m, ok := current.(map[string]interface{})
+		if !ok {
+			return nil, false
+		}
+		current, ok = m[foldKey(m, p)]
+		if !ok {
+			return nil, false
+		}
+	}
+	return current, true
+}
+
+// foldKey returns the key of m matching key regardless of case, or key when
+// there is none. Files keep the case they were written in while keys match
+// case insensitively, as they do in viper
+func foldKey(m map[string]interface{}, key string) string {
+	if _, ok := m[key]; ok {
+		return key
+	}
+	for k := range m {
+		if strings.EqualFold(k, key) {
+			return k
+		}
+	}
+	return key
+}
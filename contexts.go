@@ -0,0 +1,296 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+
+	"github.com/spf13/cobra"
+	"gopkg.in/yaml.v3"
+)
+
+var ErrorNoContextName = usageError{errors.New("context name cannot be empty")}
+
+// contextConfig is one entry under contexts in the config file
+type contextConfig struct {
+	Address       string `yaml:"address,omitempty"`
+	Email         string `yaml:"email,omitempty"`
+	CredentialRef string `yaml:"credential_ref,omitempty"`
+}
+
+// contextInfo is a row of boxee config get-contexts
+type contextInfo struct {
+	Current       bool   `json:"current"`
+	Name          string `json:"name"`
+	Address       string `json:"address"`
+	Email         string `json:"email"`
+	CredentialRef string `json:"credential_ref,omitempty"`
+}
+
+// activeContextName picks the context from --context, then BOXEE_CONTEXT,
+// then current_context in the config. An empty name means the top level
+// email and address are used
+func (s *runState) activeContextName() string {
+	return s.viper.GetString("current_context")
+}
+
+// readContexts reads the merged contexts of every config file. They are not
+// read through viper since it lowercases map keys and splits them on dots
+func (s *runState) readContexts() (map[string]contextConfig, error) {
+	raw, err := yaml.Marshal(s.config.merged["contexts"])
+	if err != nil {
+		return nil, err
+	}
+	contexts := map[string]contextConfig{}
+	if err := yaml.Unmarshal(raw, &contexts); err != nil {
+		return nil, fmt.Errorf("invalid contexts in config: %w", err)
+	}
+	return contexts, nil
+}
+
+// resolveConfigParams returns the account and server of the active context
+// without resolving any secrets
+func (s *runState) resolveConfigParams() (ConfigParams, error) {
+	if err := s.readConfig(); err != nil {
+		return ConfigParams{}, err
+	}
+	cParams := ConfigParams{
+		Email:   s.viper.GetString("email"),
+		Address: s.viper.GetString("address"),
+	}
+	name := s.activeContextName()
+	if name == "" {
+		var err error
+		cParams.Transport, err = s.resolveTransportConfig(nil)
+		return cParams, err
+	}
+	contexts, err := s.readContexts()
+	if err != nil {
+		return cParams, err
+	}
+	c, ok := contexts[name]
+	if !ok {
+		return cParams, fmt.Errorf("context %v not found. Run boxee config get-contexts to list contexts", name)
+	}
+	rawContexts, _ := s.config.merged["contexts"].(map[string]interface{})
+	contextSettings, _ := rawContexts[name].(map[string]interface{})
+	if cParams.Transport, err = s.resolveTransportConfig(contextSettings); err != nil {
+		return cParams, err
+	}
+	cParams.Context = name
+	cParams.CredentialRef = c.CredentialRef
+	//a context inherits the top level values it does not set and loses to
+	//values from the environment or flags
+	if c.Address != "" && !s.config.overridden("address") {
+		cParams.Address = c.Address
+	}
+	if c.Email != "" && !s.config.overridden("email") {
+		cParams.Email = c.Email
+	}
+	return cParams, nil
+}
+
+// configGetContextsOptions are the options of boxee config get-contexts
+type configGetContextsOptions struct {
+	cmdDeps
+}
+
+func newConfigGetContextsOptions(deps cmdDeps) *configGetContextsOptions {
+	return &configGetContextsOptions{cmdDeps: deps}
+}
+
+func (o *configGetContextsOptions) Run(ctx context.Context) error {
+	if err := o.state.readConfig(); err != nil {
+		return err
+	}
+	contexts, err := o.state.readContexts()
+	if err != nil {
+		return err
+	}
+	current := o.state.activeContextName()
+	var names []string
+	for name := range contexts {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	infos := []contextInfo{}
+	for _, name := range names {
+		c := contexts[name]
+		infos = append(infos, contextInfo{
+			Current:       name == current,
+			Name:          name,
+			Address:       c.Address,
+			Email:         c.Email,
+			CredentialRef: c.CredentialRef,
+		})
+	}
+	return o.print(infos)
+}
+
+func configGetContexts(deps cmdDeps) *cobra.Command {
+	o := newConfigGetContextsOptions(deps)
+	return &cobra.Command{
+		Use:   "get-contexts",
+		Short: "list contexts",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return o.Run(cmd.Context())
+		},
+	}
+}
+
+// configSetContextOptions are the options of boxee config set-context
+type configSetContextOptions struct {
+	cmdDeps
+	Name    string
+	Context contextConfig
+	// AddressSet, EmailSet and CredentialRefSet are true for the flags that
+	// were passed. Only those are changed on an existing context
+	AddressSet       bool
+	EmailSet         bool
+	CredentialRefSet bool
+}
+
+func newConfigSetContextOptions(deps cmdDeps) *configSetContextOptions {
+	return &configSetContextOptions{cmdDeps: deps}
+}
+
+func (o *configSetContextOptions) Run(ctx context.Context) error {
+	if o.Name == "" {
+		return ErrorNoContextName
+	}
+	//validate like config set does before anything is written
+	if o.AddressSet {
+		if _, err := parseConfigValue("address", o.Context.Address); err != nil {
+			return err
+		}
+	}
+	if o.EmailSet {
+		if _, err := parseConfigValue("email", o.Context.Email); err != nil {
+			return err
+		}
+	}
+	return o.state.editConfigFile(func(settings map[string]interface{}) error {
+		contexts, _ := settings["contexts"].(map[string]interface{})
+		if contexts == nil {
+			contexts = map[string]interface{}{}
+		}
+		entry, _ := contexts[o.Name].(map[string]interface{})
+		if entry == nil {
+			entry = map[string]interface{}{}
+		}
+		if o.AddressSet {
+			entry["address"] = o.Context.Address
+		}
+		if o.EmailSet {
+			entry["email"] = o.Context.Email
+		}
+		if o.CredentialRefSet {
+			entry["credential_ref"] = o.Context.CredentialRef
+		}
+		contexts[o.Name] = entry
+		settings["contexts"] = contexts
+		fmt.Fprintf(o.ErrOut, "context %v saved\n", o.Name)
+		return nil
+	})
+}
+
+func configSetContext(deps cmdDeps) *cobra.Command {
+	o := newConfigSetContextOptions(deps)
+	setContextCmd := &cobra.Command{
+		Use:   "set-context NAME",
+		Short: "create or update a context",
+		Long: `
+		create or update a context. Only the flags passed are changed on an existing context`,
+		Args: cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			o.Name = args[0]
+			o.AddressSet = cmd.Flags().Changed("address")
+			o.EmailSet = cmd.Flags().Changed("email")
+			o.CredentialRefSet = cmd.Flags().Changed("credential-ref")
+			return o.Run(cmd.Context())
+		},
+	}
+	setContextCmd.Flags().StringVarP(&o.Context.Address, "address", "a", "", "box-ee server for this context")
+	setContextCmd.Flags().StringVarP(&o.Context.Email, "email", "e", "", "account email for this context")
+	setContextCmd.Flags().StringVarP(&o.Context.CredentialRef, "credential-ref", "", "", "name the context's secrets are stored under (default email@address)")
+	return setContextCmd
+}
+
+// configUseContextOptions are the options of boxee config use-context
+type configUseContextOptions struct {
+	cmdDeps
+	Name string
+}
+
+func newConfigUseContextOptions(deps cmdDeps) *configUseContextOptions {
+	return &configUseContextOptions{cmdDeps: deps}
+}
+
+func (o *configUseContextOptions) Run(ctx context.Context) error {
+	if err := o.state.readConfig(); err != nil {
+		return err
+	}
+	contexts, err := o.state.readContexts()
+	if err != nil {
+		return err
+	}
+	if _, ok := contexts[o.Name]; !ok {
+		return fmt.Errorf("context %v not found. Create it with boxee config set-context", o.Name)
+	}
+	return o.state.editConfigFile(func(settings map[string]interface{}) error {
+		settings["current_context"] = o.Name
+		fmt.Fprintf(o.ErrOut, "switched to context %v\n", o.Name)
+		return nil
+	})
+}
+
+func configUseContext(deps cmdDeps) *cobra.Command {
+	o := newConfigUseContextOptions(deps)
+	return &cobra.Command{
+		Use:   "use-context NAME",
+		Short: "switch the current context",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			o.Name = args[0]
+			return o.Run(cmd.Context())
+		},
+	}
+}
+
+// configDeleteContextOptions are the options of boxee config delete-context
+type configDeleteContextOptions struct {
+	cmdDeps
+	Name string
+}
+
+func newConfigDeleteContextOptions(deps cmdDeps) *configDeleteContextOptions {
+	return &configDeleteContextOptions{cmdDeps: deps}
+}
+
+func (o *configDeleteContextOptions) Run(ctx context.Context) error {
+	return o.state.editConfigFile(func(settings map[string]interface{}) error {
+		contexts, _ := settings["contexts"].(map[string]interface{})
+		if _, ok := contexts[o.Name]; !ok {
+			return fmt.Errorf("context %v not found", o.Name)
+		}
+		delete(contexts, o.Name)
+		if settings["current_context"] == o.Name {
+			delete(settings, "current_context")
+		}
+		return nil
+	})
+}
+
+func configDeleteContext(deps cmdDeps) *cobra.Command {
+	o := newConfigDeleteContextOptions(deps)
+	return &cobra.Command{
+		Use:   "delete-context NAME",
+		Short: "delete a context",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			o.Name = args[0]
+			return o.Run(cmd.Context())
+		},
+	}
+}
@@ -0,0 +1,578 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/spf13/cobra"
+	"golang.org/x/crypto/scrypt"
+	"golang.org/x/term"
+)
+
+const (
+	storeKeyring   string = "keyring"
+	storeFile      string = "file"
+	storePlaintext string = "plaintext"
+
+	credentialFile    string = "credentials"
+	keyringService    string = "boxee"
+	credSessionToken  string = "session_token"
+	credSessionIssued string = "session_issued"
+	credClientKey     string = "client_key"
+	passphraseEnvName string = "BOXEE_PASSPHRASE"
+
+	// legacyCredentialFile is where older versions kept the file store, in
+	// the working directory
+	legacyCredentialFile string = ".box-ee.credentials"
+)
+
+var (
+	ErrCredentialNotFound = errors.New("credential not found")
+	ErrKeyringUnavailable = errors.New("no os keyring available. Install secret-tool (libsecret) and run a secret service, or set BOXEE_CREDENTIAL_STORE=file")
+	ErrPassphraseRequired = errors.New("the encrypted credential file needs a passphrase. Set " + passphraseEnvName + " or run from a terminal")
+	ErrWrongPassphrase    = errors.New("unable to decrypt the credential file. Wrong passphrase?")
+	ErrorUnknownCredStore = errors.New("unknown credential store. Use one of keyring, file or plaintext")
+)
+
+// credentialStore keeps secrets such as the session token and device client
+// keys. Names are scoped by the caller, see credentialName
+type credentialStore interface {
+	Get(name string) (string, error)
+	Set(name, value string) error
+	Delete(name string) error
+}
+
+// newCredentialStore returns the backend for kind
+func (s *runState) newCredentialStore(kind string) (credentialStore, error) {
+	switch kind {
+	case storeKeyring:
+		return keyringStore{}, nil
+	case storeFile:
+		path := s.viper.GetString("credential_file")
+		if path == "" {
+			path = filepath.Join(s.userConfigDir(), credentialFile)
+			if err := s.moveLegacyCredentialFile(path); err != nil {
+				return nil, err
+			}
+		}
+		return &fileStore{path: path, env: s.env}, nil
+	case storePlaintext:
+		return plaintextStore{state: s}, nil
+	default:
+		return nil, ErrorUnknownCredStore
+	}
+}
+
+// moveLegacyCredentialFile moves a .box-ee.credentials left in the working
+// directory by an older version to path. When path already exists the old
+// file is no longer read and only warned about
+func (s *runState) moveLegacyCredentialFile(path string) error {
+	legacy := s.env.workPath(legacyCredentialFile)
+	raw, err := ioutil.ReadFile(legacy)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if _, err := os.Stat(path); err == nil {
+		fmt.Fprintf(s.env.Stderr, "warning: %v is no longer read, the credential file is %v\n", legacy, path)
+		return nil
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return err
+	}
+	if err := ioutil.WriteFile(path, raw, 0600); err != nil {
+		return err
+	}
+	if err := os.Remove(legacy); err != nil {
+		return err
+	}
+	fmt.Fprintf(s.env.Stderr, "moved the credential file %v to %v\n", legacy, path)
+	return nil
+}
+
+// configuredCredentialStoreKind resolves the store from BOXEE_CREDENTIAL_STORE,
+// then credential_store in the config. Without either the os keyring is used
+// when available and the encrypted file otherwise. Plaintext is never a default
+func (s *runState) configuredCredentialStoreKind() string {
+	if kind := s.viper.GetString("credential_store"); kind != "" {
+		return kind
+	}
+	if keyringAvailable() {
+		return storeKeyring
+	}
+	return storeFile
+}
+
+func (s *runState) configuredCredentialStore() (credentialStore, error) {
+	if s.flags.Replay != "" {
+		return replayStore{}, nil
+	}
+	return s.newCredentialStore(s.configuredCredentialStoreKind())
+}
+
+// credentialName scopes a secret to the account and server it belongs to. A
+// context can pin the scope with credential_ref
+func credentialName(cParams ConfigParams, name string) string {
+	ref := cParams.CredentialRef
+	if ref == "" {
+		ref = fmt.Sprintf("%v@%v", cParams.Email, cParams.Address)
+	}
+	return ref + "/" + name
+}
+
+// plaintextStore keeps secrets under credentials in the config file. This is
+// how tokens were stored before the credential store existed and must be opted into
+type plaintextStore struct {
+	state *runState
+}
+
+func (p plaintextStore) Get(name string) (string, error) {
+	creds, _ := p.state.config.merged["credentials"].(map[string]interface{})
+	v, _ := creds[name].(string)
+	if v == "" {
+		return "", ErrCredentialNotFound
+	}
+	return v, nil
+}
+
+func (p plaintextStore) Set(name, value string) error {
+	return p.state.editConfigFile(func(settings map[string]interface{}) error {
+		creds, _ := settings["credentials"].(map[string]interface{})
+		if creds == nil {
+			creds = map[string]interface{}{}
+		}
+		creds[name] = value
+		settings["credentials"] = creds
+		return nil
+	})
+}
+
+func (p plaintextStore) Delete(name string) error {
+	return p.state.editConfigFile(func(settings map[string]interface{}) error {
+		creds, _ := settings["credentials"].(map[string]interface{})
+		delete(creds, name)
+		if len(creds) == 0 {
+			delete(settings, "credentials")
+		}
+		return nil
+	})
+}
+
+// keyringStore uses the os keyring through secret-tool on linux and the
+// security tool on macOS
+type keyringStore struct{}
+
+// keyringProbe caches the answer of keyringAvailable for the process
+var keyringProbe struct {
+	once sync.Once
+	ok   bool
+}
+
+// keyringAvailable reports whether the keyring tool is installed and answers a
+// lookup. secret-tool is often installed where no secret service runs, and
+// then fails every call
+func keyringAvailable() bool {
+	keyringProbe.once.Do(func() {
+		switch runtime.GOOS {
+		case "linux", "freebsd", "openbsd", "darwin":
+		default:
+			return
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		_, err := keyringLookup(ctx, keyringService+"/probe")
+		keyringProbe.ok = err == nil || errors.Is(err, ErrCredentialNotFound)
+	})
+	return keyringProbe.ok
+}
+
+// keyringLookup reads a secret. A missing entry is ErrCredentialNotFound, any
+// other failure of the tool is returned with its output
+func keyringLookup(ctx context.Context, name string) (string, error) {
+	var cmd *exec.Cmd
+	if runtime.GOOS == "darwin" {
+		cmd = exec.CommandContext(ctx, "security", "find-generic-password", "-s", keyringService, "-a", name, "-w")
+	} else {
+		cmd = exec.CommandContext(ctx, "secret-tool", "lookup", "service", keyringService, "account", name)
+	}
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	value := strings.TrimRight(string(out), "\n")
+	switch {
+	case err == nil && value != "":
+		return value, nil
+	case err == nil, keyringNotFound(err, stderr.Bytes()):
+		return "", ErrCredentialNotFound
+	default:
+		return "", fmt.Errorf("unable to read from the os keyring: %v %s", err, bytes.TrimSpace(stderr.Bytes()))
+	}
+}
+
+// keyringNotFound reports whether a failed keyring call only found nothing.
+// security exits 44 for a missing item, secret-tool exits 1 without output
+func keyringNotFound(err error, stderr []byte) bool {
+	var exitErr *exec.ExitError
+	if !errors.As(err, &exitErr) {
+		return false
+	}
+	if runtime.GOOS == "darwin" {
+		return exitErr.ExitCode() == 44
+	}
+	return exitErr.ExitCode() == 1 && len(bytes.TrimSpace(stderr)) == 0
+}
+
+func (keyringStore) Get(name string) (string, error) {
+	if !keyringAvailable() {
+		return "", ErrKeyringUnavailable
+	}
+	return keyringLookup(context.Background(), name)
+}
+
+func (keyringStore) Set(name, value string) error {
+	if !keyringAvailable() {
+		return ErrKeyringUnavailable
+	}
+	var cmd *exec.Cmd
+	if runtime.GOOS == "darwin" {
+		//use interactive mode so the secret is not visible in the process list
+		cmd = exec.Command("security", "-i")
+		cmd.Stdin = strings.NewReader(fmt.Sprintf("add-generic-password -U -s %v -a %v -w %v\n",
+			keyringService, quoteSecurityArg(name), quoteSecurityArg(value)))
+	} else {
+		cmd = exec.Command("secret-tool", "store", "--label", "box-ee "+name, "service", keyringService, "account", name)
+		cmd.Stdin = strings.NewReader(value)
+	}
+	if out, err := cmd.CombinedOutput(); err != nil {
+		return fmt.Errorf("unable to write to the os keyring: %v %s", err, bytes.TrimSpace(out))
+	}
+	return nil
+}
+
+func (keyringStore) Delete(name string) error {
+	if !keyringAvailable() {
+		return ErrKeyringUnavailable
+	}
+	var cmd *exec.Cmd
+	if runtime.GOOS == "darwin" {
+		cmd = exec.Command("security", "delete-generic-password", "-s", keyringService, "-a", name)
+	} else {
+		cmd = exec.Command("secret-tool", "clear", "service", keyringService, "account", name)
+	}
+	//deleting a missing entry is not an error
+	if out, err := cmd.CombinedOutput(); err != nil && !keyringNotFound(err, out) {
+		return fmt.Errorf("unable to delete from the os keyring: %v %s", err, bytes.TrimSpace(out))
+	}
+	return nil
+}
+
+func quoteSecurityArg(s string) string {
+	return `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(s) + `"`
+}
+
+// fileStore keeps secrets in a file encrypted with AES-GCM using a key derived
+// from a passphrase with scrypt
+type fileStore struct {
+	path       string
+	passphrase []byte
+	// env is prompted for the passphrase when it is not set
+	env *cliEnv
+}
+
+type encryptedFile struct {
+	Salt  []byte `json:"salt"`
+	Nonce []byte `json:"nonce"`
+	Data  []byte `json:"data"`
+}
+
+func (s *fileStore) Get(name string) (string, error) {
+	secrets, err := s.load()
+	if err != nil {
+		return "", err
+	}
+	v, ok := secrets[name]
+	if !ok {
+		return "", ErrCredentialNotFound
+	}
+	return v, nil
+}
+
+func (s *fileStore) Set(name, value string) error {
+	secrets, err := s.load()
+	if err != nil {
+		return err
+	}
+	secrets[name] = value
+	return s.save(secrets)
+}
+
+func (s *fileStore) Delete(name string) error {
+	secrets, err := s.load()
+	if err != nil {
+		return err
+	}
+	if _, ok := secrets[name]; !ok {
+		return nil
+	}
+	delete(secrets, name)
+	return s.save(secrets)
+}
+
+func (s *fileStore) load() (map[string]string, error) {
+	secrets := map[string]string{}
+	raw, err := ioutil.ReadFile(s.path)
+	if errors.Is(err, os.ErrNotExist) {
+		return secrets, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var ef encryptedFile
+	if err := json.Unmarshal(raw, &ef); err != nil {
+		return nil, fmt.Errorf("corrupt credential file %v: %w", s.path, err)
+	}
+	gcm, err := s.cipher(ef.Salt)
+	if err != nil {
+		return nil, err
+	}
+	plain, err := gcm.Open(nil, ef.Nonce, ef.Data, nil)
+	if err != nil {
+		return nil, ErrWrongPassphrase
+	}
+	if err := json.Unmarshal(plain, &secrets); err != nil {
+		return nil, fmt.Errorf("corrupt credential file %v: %w", s.path, err)
+	}
+	return secrets, nil
+}
+
+func (s *fileStore) save(secrets map[string]string) error {
+	plain, err := json.Marshal(secrets)
+	if err != nil {
+		return err
+	}
+	ef := encryptedFile{Salt: make([]byte, 16)}
+	if _, err := rand.Read(ef.Salt); err != nil {
+		return err
+	}
+	gcm, err := s.cipher(ef.Salt)
+	if err != nil {
+		return err
+	}
+	ef.Nonce = make([]byte, gcm.NonceSize())
+	if _, err := rand.Read(ef.Nonce); err != nil {
+		return err
+	}
+	ef.Data = gcm.Seal(nil, ef.Nonce, plain, nil)
+	raw, err := json.Marshal(ef)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(s.path), 0700); err != nil {
+		return err
+	}
+	return ioutil.WriteFile(s.path, raw, 0600)
+}
+
+func (s *fileStore) cipher(salt []byte) (cipher.AEAD, error) {
+	if s.passphrase == nil {
+		passphrase, err := s.env.readPassphrase()
+		if err != nil {
+			return nil, err
+		}
+		s.passphrase = passphrase
+	}
+	key, err := scrypt.Key(s.passphrase, salt, 1<<15, 8, 1, 32)
+	if err != nil {
+		return nil, err
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// readPassphrase takes the passphrase from the environment or asks for it on the terminal
+func (e *cliEnv) readPassphrase() ([]byte, error) {
+	if p := os.Getenv(passphraseEnvName); p != "" {
+		return []byte(p), nil
+	}
+	in, ok := e.terminalIn()
+	if !ok {
+		return nil, ErrPassphraseRequired
+	}
+	fmt.Fprint(e.Stderr, "credential file passphrase: ")
+	p, err := term.ReadPassword(int(in.Fd()))
+	fmt.Fprintln(e.Stderr)
+	if err != nil {
+		return nil, err
+	}
+	if len(p) == 0 {
+		return nil, ErrPassphraseRequired
+	}
+	return p, nil
+}
+
+// plaintextSecret is a secret found in a config file by boxee credentials migrate
+type plaintextSecret struct {
+	// name is the name in the credential store
+	name  string
+	value string
+	// path is the config file holding the secret. legacyKey is the top level
+	// key of secrets from before the credential store, others are under credentials
+	path      string
+	legacyKey string
+}
+
+// plaintextSecrets returns the secrets kept in the config files, from the
+// lowest precedence file to the highest so the effective value is stored last
+func (s *runState) plaintextSecrets(cParams ConfigParams) []plaintextSecret {
+	var secrets []plaintextSecret
+	for _, l := range s.config.layers {
+		if l.Source != layerSystem && l.Source != layerUser && l.Source != layerProject {
+			continue
+		}
+		for _, key := range []string{credSessionToken, credClientKey} {
+			if value, _ := l.Settings[key].(string); value != "" {
+				secrets = append(secrets, plaintextSecret{name: credentialName(cParams, key), value: value, path: l.Origin, legacyKey: key})
+			}
+		}
+		creds, _ := l.Settings["credentials"].(map[string]interface{})
+		var names []string
+		for name := range creds {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			if value, _ := creds[name].(string); value != "" {
+				secrets = append(secrets, plaintextSecret{name: name, value: value, path: l.Origin})
+			}
+		}
+	}
+	return secrets
+}
+
+type migrateResult struct {
+	Name   string `json:"name"`
+	Store  string `json:"store"`
+	Status string `json:"status"`
+}
+
+func getCredentialsCmd(deps cmdDeps) *cobra.Command {
+	//credentials root command. Hang all sub commands related to stored secrets off of this one
+	credentialsCmd := &cobra.Command{
+		Use:   "credentials",
+		Short: "credential store actions command",
+		Long: `
+			The root command for the credential store. Session tokens and device client keys are kept in the
+			os keyring or an encrypted file instead of the config file. Set credential_store in the config or
+			BOXEE_CREDENTIAL_STORE to keyring, file or plaintext. Possible subcommands include migrate`,
+	}
+
+	credentialsCmd.AddCommand(credentialsMigrate(deps))
+	return credentialsCmd
+}
+
+// credentialsMigrateOptions are the options of boxee credentials migrate
+type credentialsMigrateOptions struct {
+	cmdDeps
+	// To is the store to migrate to, the configured store when empty
+	To string
+}
+
+func newCredentialsMigrateOptions(deps cmdDeps) *credentialsMigrateOptions {
+	return &credentialsMigrateOptions{cmdDeps: deps}
+}
+
+func (o *credentialsMigrateOptions) Run(ctx context.Context) error {
+	if err := o.state.readConfig(); err != nil {
+		return err
+	}
+	to := o.To
+	if to == "" {
+		to = o.state.configuredCredentialStoreKind()
+	}
+	if to == storePlaintext {
+		return errors.New("migrate moves secrets out of the config file. Choose keyring or file with --to")
+	}
+	store, err := o.state.newCredentialStore(to)
+	if err != nil {
+		return err
+	}
+	cParams, err := o.state.resolveConfigParams()
+	if err != nil {
+		return err
+	}
+
+	secrets := o.state.plaintextSecrets(cParams)
+	//store every secret before touching the config files, so a
+	//failure leaves the plaintext copies and credential_store as they were
+	results := []migrateResult{}
+	for _, secret := range secrets {
+		if err := store.Set(secret.name, secret.value); err != nil {
+			return fmt.Errorf("unable to migrate %v, nothing was removed from the config: %w", secret.name, err)
+		}
+		results = append(results, migrateResult{Name: secret.name, Store: to, Status: "migrated"})
+	}
+
+	//remove each secret from the file it came from
+	for _, secret := range secrets {
+		err := editConfigFileAt(secret.path, func(settings map[string]interface{}) error {
+			if secret.legacyKey != "" {
+				delete(settings, secret.legacyKey)
+				return nil
+			}
+			creds, _ := settings["credentials"].(map[string]interface{})
+			delete(creds, secret.name)
+			if len(creds) == 0 {
+				delete(settings, "credentials")
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+	}
+	err = o.state.editConfigFile(func(settings map[string]interface{}) error {
+		settings["credential_store"] = to
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	return o.print(results)
+}
+
+func credentialsMigrate(deps cmdDeps) *cobra.Command {
+	o := newCredentialsMigrateOptions(deps)
+	migrateCmd := &cobra.Command{
+		Use:   "migrate",
+		Short: "move plaintext tokens into the credential store",
+		Long: `
+		move the secrets under credentials and the legacy session_token and client_key out of the config
+		files into the credential store and record the store as credential_store in the config. The config
+		files are only changed once every secret is stored`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return o.Run(cmd.Context())
+		},
+	}
+	migrateCmd.Flags().StringVarP(&o.To, "to", "", "", "credential store to migrate to, keyring or file (default keyring when available)")
+	return migrateCmd
+}
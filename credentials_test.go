@@ -0,0 +1,72 @@
+package main
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestFileStore(t *testing.T) {
+	//a missing parent dir is created on the first write
+	path := filepath.Join(t.TempDir(), "boxee", "credentials.enc")
+	store := &fileStore{path: path, passphrase: []byte("correct horse")}
+	if _, err := store.Get("qa/session_token"); !errors.Is(err, ErrCredentialNotFound) {
+		t.Fatalf("get from a missing file returned %v, want ErrCredentialNotFound", err)
+	}
+	if err := store.Set("qa/session_token", "sess_qa"); err != nil {
+		t.Fatal(err)
+	}
+	if err := store.Set("qa/client_key", "ck_qa"); err != nil {
+		t.Fatal(err)
+	}
+
+	raw, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(string(raw), "sess_qa") {
+		t.Fatal("the credential file holds the session token in the clear")
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if perm := info.Mode().Perm(); perm != 0600 {
+		t.Errorf("credential file mode %v, want 0600", perm)
+	}
+
+	cases := []struct {
+		name       string
+		passphrase string
+		want       string
+		wantErr    error
+	}{
+		{name: "same passphrase", passphrase: "correct horse", want: "sess_qa"},
+		{name: "wrong passphrase", passphrase: "battery staple", wantErr: ErrWrongPassphrase},
+	}
+	for _, c := range cases {
+		reopened := &fileStore{path: path, passphrase: []byte(c.passphrase)}
+		got, err := reopened.Get("qa/session_token")
+		if !errors.Is(err, c.wantErr) || got != c.want {
+			t.Errorf("%v: got %q, %v, want %q, %v", c.name, got, err, c.want, c.wantErr)
+		}
+		if c.wantErr != nil {
+			if err := reopened.Set("qa/session_token", "sess_other"); !errors.Is(err, c.wantErr) {
+				t.Errorf("%v: set returned %v, want %v", c.name, err, c.wantErr)
+			}
+		}
+	}
+
+	if err := store.Delete("qa/session_token"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := store.Get("qa/session_token"); !errors.Is(err, ErrCredentialNotFound) {
+		t.Fatalf("get after delete returned %v, want ErrCredentialNotFound", err)
+	}
+	if got, err := store.Get("qa/client_key"); err != nil || got != "ck_qa" {
+		t.Fatalf("delete also touched the client key: %q, %v", got, err)
+	}
+}
@@ -0,0 +1,155 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"time"
+
+	"github.com/epuerta9/box-ee-cli/pkg/boxeetest"
+	"github.com/spf13/cobra"
+)
+
+func getDevCmd(deps cmdDeps) *cobra.Command {
+	//dev root command. Hang all sub commands for local development off of this one
+	devCmd := &cobra.Command{
+		Use:   "dev",
+		Short: "local development tools",
+		Long: `
+			The root command for local development. Possible subcommands include server`,
+	}
+
+	devCmd.AddCommand(devServer(deps))
+	return devCmd
+}
+
+// devServerOptions are the options of boxee dev server
+type devServerOptions struct {
+	cmdDeps
+	Listen string
+	// Fixtures is a yaml or json file replacing the demo account
+	Fixtures string
+	Empty    bool
+	// Seed is only used when SeedSet, other runs are random
+	Seed    int64
+	SeedSet bool
+	Quiet   bool
+	Faults  boxeetest.Faults
+}
+
+func newDevServerOptions(deps cmdDeps) *devServerOptions {
+	return &devServerOptions{cmdDeps: deps, Listen: "127.0.0.1:8080"}
+}
+
+// Run serves the mock until ctx is cancelled
+func (o *devServerOptions) Run(ctx context.Context) error {
+	if err := o.Faults.Validate(); err != nil {
+		return err
+	}
+	fixtures := boxeetest.DefaultFixtures()
+	if o.Empty {
+		fixtures = boxeetest.Fixtures{}
+	}
+	if o.Fixtures != "" {
+		var err error
+		if fixtures, err = boxeetest.LoadFixtures(o.state.env.workPath(o.Fixtures)); err != nil {
+			return err
+		}
+	}
+	opts := []boxeetest.Option{boxeetest.WithFaults(o.Faults)}
+	if o.SeedSet {
+		opts = append(opts, boxeetest.WithSeed(o.Seed))
+	}
+	mock := boxeetest.New(opts...)
+	if err := mock.Seed(fixtures); err != nil {
+		return err
+	}
+
+	listener, err := net.Listen("tcp", o.Listen)
+	if err != nil {
+		return err
+	}
+	var handler http.Handler = mock
+	if !o.Quiet {
+		handler = logRequests(mock, o.ErrOut)
+	}
+	server := &http.Server{Handler: handler}
+
+	address := "http://" + listener.Addr().String()
+	fmt.Fprintf(o.ErrOut, "box-ee dev server listening on %v\n", address)
+	fmt.Fprintf(o.ErrOut, "point boxee at it with: boxee config set-context dev --address %v && boxee config use-context dev\n", address)
+	for _, u := range fixtures.Users {
+		fmt.Fprintf(o.ErrOut, "account %v, password %v\n", u.Email, u.Password)
+	}
+
+	errs := make(chan error, 1)
+	go func() { errs <- server.Serve(listener) }()
+	select {
+	case err := <-errs:
+		return err
+	case <-ctx.Done():
+	}
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := server.Shutdown(shutdownCtx); err != nil {
+		return err
+	}
+	if err := <-errs; !errors.Is(err, http.ErrServerClosed) {
+		return err
+	}
+	fmt.Fprintln(o.ErrOut, "box-ee dev server stopped")
+	return nil
+}
+
+func devServer(deps cmdDeps) *cobra.Command {
+	o := newDevServerOptions(deps)
+	devServerCmd := &cobra.Command{
+		Use:   "server",
+		Short: "run a local mock of the box-ee api",
+		Long: `
+		serve an in-memory mock of every box-ee api route for offline development and firmware testing.
+		State starts from --fixtures, a yaml or json file of users, devices and trackings, or from a demo
+		account when none is given, and is lost on exit. --latency, --error-rate and --throttle-rate inject
+		slow responses, 5xx and 429 answers`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			o.SeedSet = cmd.Flags().Changed("seed")
+			return o.Run(cmd.Context())
+		},
+	}
+	devServerCmd.Flags().StringVarP(&o.Listen, "listen", "l", o.Listen, "address to listen on")
+	devServerCmd.Flags().StringVarP(&o.Fixtures, "fixtures", "f", "", "yaml or json file with the users, devices and trackings to start with")
+	devServerCmd.Flags().BoolVarP(&o.Empty, "empty", "", false, "start without the demo account")
+	devServerCmd.Flags().Int64VarP(&o.Seed, "seed", "", 0, "seed for generated tokens, keys, pin keys and faults, for reproducible runs")
+	devServerCmd.Flags().BoolVarP(&o.Quiet, "quiet", "q", false, "do not log requests")
+	devServerCmd.Flags().DurationVarP(&o.Faults.Latency, "latency", "", 0, "delay every response by this long")
+	devServerCmd.Flags().DurationVarP(&o.Faults.Jitter, "jitter", "", 0, "add up to this much random delay to every response")
+	devServerCmd.Flags().Float64VarP(&o.Faults.ErrorRate, "error-rate", "", 0, "fraction of requests answered with --error-status, between 0 and 1")
+	devServerCmd.Flags().IntVarP(&o.Faults.ErrorStatus, "error-status", "", http.StatusInternalServerError, "status of injected server errors")
+	devServerCmd.Flags().Float64VarP(&o.Faults.ThrottleRate, "throttle-rate", "", 0, "fraction of requests answered 429, between 0 and 1")
+	devServerCmd.Flags().DurationVarP(&o.Faults.RetryAfter, "retry-after", "", time.Second, "Retry-After sent with injected 429 responses")
+	return devServerCmd
+}
+
+// statusWriter keeps the response status for logRequests
+type statusWriter struct {
+	http.ResponseWriter
+	status int
+}
+
+func (w *statusWriter) WriteHeader(status int) {
+	w.status = status
+	w.ResponseWriter.WriteHeader(status)
+}
+
+// logRequests writes a line per request with its status and duration
+func logRequests(next http.Handler, w io.Writer) http.Handler {
+	return http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		sw := &statusWriter{ResponseWriter: rw, status: http.StatusOK}
+		next.ServeHTTP(sw, r)
+		fmt.Fprintf(w, "%v %v %v %d %v\n", start.Format("15:04:05"), r.Method, r.URL.RequestURI(), sw.status, time.Since(start).Round(time.Millisecond))
+	})
+}
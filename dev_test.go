@@ -0,0 +1,25 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"testing"
+)
+
+func TestDevServerStopsWithContext(t *testing.T) {
+	h := newCLIHarness(t)
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	stdout, stderr, code := h.run(ctx, "", "dev", "server", "--listen", "127.0.0.1:0", "--seed", "1")
+	got := fmt.Sprintf("--- stdout\n%v--- stderr\n%v--- exit %d\n", stdout, stderr, code)
+	compareGolden(t, "dev/server", h.scrub(got))
+}
+
+func TestDevServerFlags(t *testing.T) {
+	runCLICases(t, []cliCase{
+		{name: "dev/server_bad_error_rate", args: []string{"dev", "server", "--error-rate", "2"}},
+		{name: "dev/server_bad_error_status", args: []string{"dev", "server", "--error-status", "404"}},
+		{name: "dev/server_missing_fixtures", args: []string{"dev", "server", "--fixtures", "missing.yaml"}},
+		{name: "dev/server_bad_fixtures", args: []string{"dev", "server", "--fixtures", "fixtures.yaml"}, files: map[string]string{"fixtures.yaml": "users:\n  - password: x\n"}},
+	})
+}
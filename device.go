@@ -2,244 +2,374 @@ package main
 
 import (
 	"context"
-	"encoding/json"
-	"io/ioutil"
-	"os"
+	"errors"
 
+	"github.com/epuerta9/box-ee-cli/pkg/boxee"
 	"github.com/spf13/cobra"
 )
 
-var (
-	deviceName string
-	deviceType string
-	deviceId   string
-)
-
-func getDeviceCmd() *cobra.Command {
+func getDeviceCmd(deps cmdDeps) *cobra.Command {
 	//device root command. Hang all sub commands related to device off of this one
 	deviceCmd := &cobra.Command{
-		Use:   "device",
-		Short: "device actions command",
+		Use:         "device",
+		Short:       "device actions command",
+		Annotations: sessionAnnotations,
 		Long: `
-			The root command for device. Possible subcommands include add/list/delete/update`,
+			The root command for device. Possible subcommands include add/get/list/delete/update`,
 	}
 
 	//add sub commands
-	deviceCmd.AddCommand(deviceAdd())
-	deviceCmd.AddCommand(deviceUpdate())
-	deviceCmd.AddCommand(deviceList())
-	deviceCmd.AddCommand(deviceDelete())
-	deviceCmd.AddCommand(deviceGenerateKeys())
+	deviceCmd.AddCommand(deviceAdd(deps))
+	deviceCmd.AddCommand(deviceGet(deps))
+	deviceCmd.AddCommand(deviceUpdate(deps))
+	deviceCmd.AddCommand(deviceList(deps))
+	deviceCmd.AddCommand(deviceDelete(deps))
+	deviceCmd.AddCommand(deviceGenerateKeys(deps))
 	return deviceCmd
 }
 
-func deviceAdd() *cobra.Command {
+// deviceAddOptions are the options of boxee device add
+type deviceAddOptions struct {
+	cmdDeps
+	Name string
+	Type string
+}
+
+func newDeviceAddOptions(deps cmdDeps) *deviceAddOptions {
+	return &deviceAddOptions{cmdDeps: deps}
+}
+
+func (o *deviceAddOptions) Run(ctx context.Context) error {
+	api, _, err := o.Clients.SessionClient()
+	if err != nil {
+		return err
+	}
+	created, err := api.Devices.Add(ctx, o.Name, o.Type)
+	if err != nil {
+		return err
+	}
+	return o.print(created)
+}
+
+func deviceAdd(deps cmdDeps) *cobra.Command {
+	o := newDeviceAddOptions(deps)
 	deviceAddCmd := &cobra.Command{
 		Use:   "add",
 		Short: "add a device",
 		Long: `
 		add a device. Required flags include device name and device type`,
 		RunE: func(cmd *cobra.Command, args []string) error {
-			var createdResponse DeviceCreatedResponse
-			//add a device
-			cParams := readValuesFromConfig()
-
-			client, err := NewClient(cParams.Address)
-			if err != nil {
-				return err
-
-			}
-			ctx := context.TODO()
-			client.RequestEditors = append(client.RequestEditors, setBoxeeAuthHeaders(cParams.SessionToken))
-			resp, err := client.AddDevice(ctx, DeviceRequestAdd{
-				DeviceName: deviceName,
-				DeviceType: deviceType,
-			})
-			if err != nil {
-				return err
-			}
-			body, _ := ioutil.ReadAll(resp.Body)
-			resp.Body.Close()
-			json.Unmarshal(body, &createdResponse)
-
-			json.NewEncoder(os.Stdout).Encode(createdResponse)
-
-			return nil
+			return o.Run(cmd.Context())
 		},
 	}
-	deviceAddCmd.Flags().StringVarP(&deviceName, "name", "n", "default", "specify a device name")
-	deviceAddCmd.Flags().StringVarP(&deviceType, "type", "t", "main", "specify a device type")
+	deviceAddCmd.Flags().StringVarP(&o.Name, "name", "n", "default", "specify a device name")
+	deviceAddCmd.Flags().StringVarP(&o.Type, "type", "t", "main", "specify a device type")
 	return deviceAddCmd
 }
-func deviceGenerateKeys() *cobra.Command {
+
+// deviceGenerateOptions are the options of boxee device generate
+type deviceGenerateOptions struct {
+	cmdDeps
+	DeviceID string
+	// Save keeps the client key in the credential store
+	Save bool
+}
+
+func newDeviceGenerateOptions(deps cmdDeps) *deviceGenerateOptions {
+	return &deviceGenerateOptions{cmdDeps: deps}
+}
+
+func (o *deviceGenerateOptions) Run(ctx context.Context) error {
+	api, cParams, err := o.Clients.SessionClient()
+	if err != nil {
+		return err
+	}
+	key, err := api.Devices.GenerateKey(ctx, o.DeviceID)
+	if err != nil {
+		return err
+	}
+	if o.Save {
+		store, err := o.state.configuredCredentialStore()
+		if err != nil {
+			return err
+		}
+		if err := store.Set(credentialName(cParams, credClientKey), key.ClientKey); err != nil {
+			return err
+		}
+	}
+	return o.print(key)
+}
+
+func deviceGenerateKeys(deps cmdDeps) *cobra.Command {
+	o := newDeviceGenerateOptions(deps)
 	deviceGenerateCmd := &cobra.Command{
 		Use:   "generate",
 		Short: "generate a device api key",
 		Long: `
 		generate a device client key used to setup the box-ee device. Required flags include device id`,
 		RunE: func(cmd *cobra.Command, args []string) error {
-			//generate device api key
-			var keyGenResp DeviceKeyGenResponse
-			if err := readConfig(); err != nil {
-				return err
-			}
-
-			cParams := readValuesFromConfig()
-			client, err := NewClient(cParams.Address)
-			if err != nil {
-				return err
-			}
-			ctx := context.TODO()
-			client.RequestEditors = append(client.RequestEditors, setBoxeeAuthHeaders(cParams.SessionToken))
-			var request DeviceRequestKeyGen
-			if deviceId == "" {
-				request = DeviceRequestKeyGen{}
-			} else {
-				request = DeviceRequestKeyGen{
-					DeviceId: &deviceId,
-				}
-			}
-			resp, err := client.GenKey(ctx, request)
-
-			if err != nil {
-				return err
-			}
-			body, _ := ioutil.ReadAll(resp.Body)
-			resp.Body.Close()
-			json.Unmarshal(body, &keyGenResp)
-			json.NewEncoder(os.Stdout).Encode(keyGenResp)
-			return nil
+			return o.Run(cmd.Context())
 		},
 	}
-	deviceGenerateCmd.Flags().StringVarP(&deviceId, "id", "i", "", "specify a device id")
+	deviceGenerateCmd.Flags().StringVarP(&o.DeviceID, "id", "i", "", "specify a device id")
+	deviceGenerateCmd.Flags().BoolVarP(&o.Save, "save", "", false, "save the client key in the credential store for boxee pin validate")
 	return deviceGenerateCmd
 }
-func deviceDelete() *cobra.Command {
+
+// deviceDeleteOptions are the options of boxee device delete
+type deviceDeleteOptions struct {
+	cmdDeps
+	DeviceID string
+}
+
+func newDeviceDeleteOptions(deps cmdDeps) *deviceDeleteOptions {
+	return &deviceDeleteOptions{cmdDeps: deps}
+}
+
+func (o *deviceDeleteOptions) Run(ctx context.Context) error {
+	if err := checkEmptyFlags([]string{o.DeviceID}); err != nil {
+		return err
+	}
+	api, _, err := o.Clients.SessionClient()
+	if err != nil {
+		return err
+	}
+	deleted, err := api.Devices.Delete(ctx, o.DeviceID)
+	if err != nil {
+		return err
+	}
+	return o.print(deleted)
+}
+
+func deviceDelete(deps cmdDeps) *cobra.Command {
+	o := newDeviceDeleteOptions(deps)
 	deviceDeleteCmd := &cobra.Command{
 		Use:   "delete",
 		Short: "delete a device",
 		Long: `
 		delete a device. Required flags include device id`,
 		RunE: func(cmd *cobra.Command, args []string) error {
-			//update a device
-			var deleteResp StandardResponse
-			if err := checkEmptyFlags([]string{deviceId}); err != nil {
-				return err
-			}
-			if err := readConfig(); err != nil {
-				return err
-			}
-			cParams := readValuesFromConfig()
-
-			client, err := NewClient(cParams.Address)
-			if err != nil {
-				return err
-
-			}
-			ctx := context.TODO()
-			client.RequestEditors = append(client.RequestEditors, setBoxeeAuthHeaders(cParams.SessionToken))
-
-			resp, err := client.DeleteDevice(ctx, &DeleteDeviceParams{
-				DeviceId: deviceId,
-			})
-			if err != nil {
-				return err
-			}
-			body, _ := ioutil.ReadAll(resp.Body)
-			resp.Body.Close()
-			json.Unmarshal(body, &deleteResp)
-			json.NewEncoder(os.Stdout).Encode(deleteResp)
-			return nil
+			return o.Run(cmd.Context())
 		},
 	}
-	deviceDeleteCmd.Flags().StringVarP(&deviceId, "id", "i", "", "specify a device id")
+	deviceDeleteCmd.Flags().StringVarP(&o.DeviceID, "id", "i", "", "specify a device id")
 	deviceDeleteCmd.MarkFlagRequired("id")
 	return deviceDeleteCmd
 }
-func deviceUpdate() *cobra.Command {
-	var toName string
+
+// deviceUpdateOptions are the options of boxee device update
+type deviceUpdateOptions struct {
+	cmdDeps
+	DeviceID string
+	ToName   string
+}
+
+func newDeviceUpdateOptions(deps cmdDeps) *deviceUpdateOptions {
+	return &deviceUpdateOptions{cmdDeps: deps}
+}
+
+func (o *deviceUpdateOptions) Run(ctx context.Context) error {
+	if err := checkEmptyFlags([]string{o.ToName, o.DeviceID}); err != nil {
+		return err
+	}
+	api, _, err := o.Clients.SessionClient()
+	if err != nil {
+		return err
+	}
+	updated, err := api.Devices.Update(ctx, o.DeviceID, o.ToName)
+	if err != nil {
+		return err
+	}
+	return o.print(updated)
+}
+
+func deviceUpdate(deps cmdDeps) *cobra.Command {
+	o := newDeviceUpdateOptions(deps)
 	deviceUpdateCmd := &cobra.Command{
 		Use:   "update",
 		Short: "update a device",
 		Long: `
 		update a device. Required flags include device id`,
 		RunE: func(cmd *cobra.Command, args []string) error {
-			//update a device
-			var updateResp StandardResponse
-			if err := checkEmptyFlags([]string{toName, deviceId}); err != nil {
-				return err
-			}
-			if err := readConfig(); err != nil {
-				return err
-			}
-			cParams := readValuesFromConfig()
-
-			client, err := NewClient(cParams.Address)
-			if err != nil {
-				return err
-
-			}
-			ctx := context.TODO()
-			client.RequestEditors = append(client.RequestEditors, setBoxeeAuthHeaders(cParams.SessionToken))
-			resp, err := client.UpdateDevice(ctx, DeviceRequestPatch{
-				DeviceId: deviceId,
-				ToName:   toName,
-			})
-			if err != nil {
-				json.NewEncoder(os.Stdout).Encode(err)
-				return err
-			}
-			body, _ := ioutil.ReadAll(resp.Body)
-			resp.Body.Close()
-			json.Unmarshal(body, &updateResp)
-			json.NewEncoder(os.Stdout).Encode(updateResp)
-
-			return nil
+			return o.Run(cmd.Context())
 		},
 	}
-	deviceUpdateCmd.Flags().StringVarP(&deviceId, "id", "i", "", "specify a device id")
-	deviceUpdateCmd.Flags().StringVarP(&toName, "to-name", "", "", "specify a device name")
+	deviceUpdateCmd.Flags().StringVarP(&o.DeviceID, "id", "i", "", "specify a device id")
+	deviceUpdateCmd.Flags().StringVarP(&o.ToName, "to-name", "", "", "specify a device name")
 	deviceUpdateCmd.MarkFlagRequired("id")
 	deviceUpdateCmd.MarkFlagRequired("to-name")
 	return deviceUpdateCmd
 }
-func deviceList() *cobra.Command {
-	var page int
-	var limit int
+
+var ErrorPageWithAll = usageError{errors.New("--page cannot be used with --all or --max-items, which start at the first page")}
+
+// listOptions are the paging options shared by the list commands
+type listOptions struct {
+	Page  int
+	Limit int
+	// All walks every page and streams the results, MaxItems stops after that
+	// many items and implies All
+	All      bool
+	MaxItems int
+	// LimitSet is true when the limit was chosen by the user. Otherwise --all
+	// uses the largest page the server allows
+	LimitSet bool
+	// PageSet is true when a page was chosen, which --all cannot start from
+	PageSet bool
+}
+
+func (o *listOptions) register(cmd *cobra.Command) {
+	cmd.Flags().IntVarP(&o.Page, "page", "p", 1, "specify page number")
+	cmd.Flags().IntVarP(&o.Limit, "limit", "l", 20, "specify a number of items to return")
+	cmd.Flags().BoolVarP(&o.All, "all", "A", false, "fetch every page and stream the results")
+	cmd.Flags().IntVarP(&o.MaxItems, "max-items", "", 0, "stop after this many items. Implies --all")
+}
+
+// validate rejects a page together with --all or --max-items
+func (o *listOptions) validate() error {
+	if o.PageSet && (o.All || o.MaxItems > 0) {
+		return ErrorPageWithAll
+	}
+	return nil
+}
+
+// streaming reports whether every page is fetched and returns the page size
+// to fetch them with
+func (o *listOptions) streaming() (bool, int) {
+	if o.All || o.MaxItems > 0 {
+		if !o.LimitSet {
+			return true, boxee.MaxPageSize
+		}
+		return true, o.Limit
+	}
+	return false, o.Limit
+}
+
+// page returns the single page to fetch without --all
+func (o *listOptions) page() boxee.ListOptions {
+	return boxee.ListOptions{Page: o.Page, Limit: o.Limit}
+}
+
+// deviceListOptions are the options of boxee device list
+type deviceListOptions struct {
+	cmdDeps
+	listOptions
+}
+
+func newDeviceListOptions(deps cmdDeps) *deviceListOptions {
+	return &deviceListOptions{cmdDeps: deps}
+}
+
+func (o *deviceListOptions) Run(ctx context.Context) error {
+	if err := o.validate(); err != nil {
+		return err
+	}
+	api, _, err := o.Clients.SessionClient()
+	if err != nil {
+		return err
+	}
+	if stream, limit := o.streaming(); stream {
+		it := api.Devices.Iter(boxee.IterOptions{Limit: limit, MaxItems: o.MaxItems})
+		return streamPages(ctx, o.Out, o.state.flags.Output, it)
+	}
+	list, err := api.Devices.List(ctx, o.page())
+	if err != nil {
+		return err
+	}
+	return o.print(list)
+}
+
+func deviceList(deps cmdDeps) *cobra.Command {
+	o := newDeviceListOptions(deps)
 	deviceListCmd := &cobra.Command{
 		Use:   "list",
 		Short: "list all devices",
+		Long: `
+		list devices one page at a time. Pass --all to walk every page and stream the results`,
 		RunE: func(cmd *cobra.Command, args []string) error {
-			//listing out all devices
-			var listResp ListDevices
-			if err := readConfig(); err != nil {
-				return err
-			}
-			cParams := readValuesFromConfig()
-
-			client, err := NewClient(cParams.Address)
-			if err != nil {
-				return err
-
-			}
-			ctx := context.TODO()
-			client.RequestEditors = append(client.RequestEditors, setBoxeeAuthHeaders(cParams.SessionToken))
-			resp, err := client.ListDevices(ctx, &ListDevicesParams{
-				Page:  &page,
-				Limit: &limit,
-			})
-			if err != nil {
-				return err
-			}
-			body, _ := ioutil.ReadAll(resp.Body)
-			resp.Body.Close()
-			json.Unmarshal(body, &listResp)
-			json.NewEncoder(os.Stdout).Encode(listResp)
-			return nil
+			o.LimitSet = cmd.Flags().Changed("limit")
+			o.PageSet = cmd.Flags().Changed("page")
+			return o.Run(cmd.Context())
 		},
 	}
-	deviceListCmd.Flags().IntVarP(&page, "page", "p", 1, "specify page number")
-	deviceListCmd.Flags().IntVarP(&limit, "limit", "l", 20, "specify a number of items to return")
-
+	o.listOptions.register(deviceListCmd)
 	return deviceListCmd
 }
+
+// deviceGetOptions are the options of boxee device get
+type deviceGetOptions struct {
+	cmdDeps
+	DeviceID string
+	Name     string
+}
+
+func newDeviceGetOptions(deps cmdDeps) *deviceGetOptions {
+	return &deviceGetOptions{cmdDeps: deps}
+}
+
+func (o *deviceGetOptions) Run(ctx context.Context) error {
+	if o.DeviceID == "" && o.Name == "" {
+		return ErrorDeviceLookup
+	}
+	api, _, err := o.Clients.SessionClient()
+	if err != nil {
+		return err
+	}
+	devices, err := api.Devices.Get(ctx, boxee.DeviceQuery{ID: o.DeviceID, Name: o.Name})
+	if err != nil {
+		return err
+	}
+	results := make([]deviceGetResult, 0, len(devices))
+	for _, d := range devices {
+		results = append(results, deviceGetResult{
+			Health:      d.Health,
+			HealthLabel: readableHealth(d.Health),
+			Msg:         d.Msg,
+			Name:        d.Name,
+			StatusCode:  d.StatusCode,
+			Type:        d.Type,
+		})
+	}
+	return o.print(results)
+}
+
+// deviceGetResult is a device printed by boxee device get. Health keeps the
+// value reported by the server for scripts, HealthLabel is for people
+type deviceGetResult struct {
+	Health      string `json:"health"`
+	HealthLabel string `json:"health_label"`
+	Msg         string `json:"msg"`
+	Name        string `json:"name"`
+	StatusCode  int    `json:"status_code"`
+	Type        string `json:"type"`
+}
+
+// readableHealth turns the numeric health reported by the server into a label
+func readableHealth(health string) string {
+	switch health {
+	case "0":
+		return "unhealthy"
+	case "1":
+		return "healthy"
+	case "":
+		return "unknown"
+	default:
+		return health
+	}
+}
+
+func deviceGet(deps cmdDeps) *cobra.Command {
+	o := newDeviceGetOptions(deps)
+	deviceGetCmd := &cobra.Command{
+		Use:   "get",
+		Short: "get a device",
+		Long: `
+		get a single device by id or by name. One of the flags device id or device name is required`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return o.Run(cmd.Context())
+		},
+	}
+	deviceGetCmd.Flags().StringVarP(&o.DeviceID, "id", "i", "", "specify a device id")
+	deviceGetCmd.Flags().StringVarP(&o.Name, "name", "n", "", "specify a device name")
+	return deviceGetCmd
+}
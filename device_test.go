@@ -0,0 +1,107 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/epuerta9/box-ee-cli/pkg/boxee"
+	"github.com/epuerta9/box-ee-cli/pkg/boxeetest"
+)
+
+func TestDeviceCommands(t *testing.T) {
+	runCLICases(t, []cliCase{
+		{name: "device/list", args: []string{"device", "list"}},
+		{name: "device/list_table", args: []string{"device", "list", "-o", "table"}},
+		{name: "device/list_wide", args: []string{"device", "list", "-o", "wide"}},
+		{name: "device/list_page", args: []string{"device", "list", "--page", "2", "--limit", "1", "-o", "yaml"}},
+		{name: "device/list_all", args: []string{"device", "list", "--all", "--limit", "1"}},
+		{name: "device/list_max_items", args: []string{"device", "list", "--max-items", "1", "-o", "csv"}},
+		{name: "device/list_page_with_all", args: []string{"device", "list", "--all", "--page", "2"}},
+		{name: "device/list_limit_too_high", args: []string{"device", "list", "--limit", "500"}},
+		{name: "device/list_jsonpath", args: []string{"device", "list", "-o", "jsonpath={.devices[*].id}"}},
+		{name: "device/list_jsonpath_missing", args: []string{"device", "list", "-o", "jsonpath={.devices[*].serial}"}},
+		{
+			name:  "device/list_server_error",
+			args:  []string{"device", "list"},
+			setup: func(srv *boxeetest.Server) { srv.FailNext(http.StatusInternalServerError, 4) },
+		},
+		{
+			name:  "device/list_throttled_then_ok",
+			args:  []string{"device", "list", "-o", "table"},
+			setup: func(srv *boxeetest.Server) { srv.FailNext(http.StatusTooManyRequests, 1) },
+		},
+		{
+			name:  "device/list_no_retries",
+			args:  []string{"device", "list", "--retries", "0"},
+			setup: func(srv *boxeetest.Server) { srv.FailNext(http.StatusServiceUnavailable, 1) },
+		},
+		{
+			name:   "device/list_expired_session",
+			args:   []string{"device", "list"},
+			config: strings.Replace(loggedInConfig, "sess_qa", "sess_revoked", 1),
+		},
+		{name: "device/list_not_logged_in", args: []string{"device", "list"}, config: loggedOutConfig},
+		{name: "device/get_by_id", args: []string{"device", "get", "--id", "dev-0001"}},
+		{name: "device/get_by_name", args: []string{"device", "get", "--name", "locker-2", "-o", "yaml"}},
+		{name: "device/get_table", args: []string{"device", "get", "--id", "dev-0001", "-o", "table"}},
+		{name: "device/get_missing", args: []string{"device", "get", "--name", "nope"}},
+		{name: "device/get_other_account", args: []string{"device", "get", "--id", "dev-0003"}},
+		{name: "device/get_no_flags", args: []string{"device", "get"}},
+		{name: "device/add", args: []string{"device", "add", "--name", "garage", "--type", "side"}},
+		{name: "device/add_defaults", args: []string{"device", "add"}},
+		{
+			name:   "device/add_then_list",
+			args:   []string{"device", "list", "-o", "table"},
+			before: [][]string{{"device", "add", "--name", "garage"}},
+		},
+		{name: "device/update", args: []string{"device", "update", "--id", "dev-0002", "--to-name", "porch"}},
+		{name: "device/update_missing", args: []string{"device", "update", "--id", "dev-9999", "--to-name", "porch"}},
+		{name: "device/update_no_id", args: []string{"device", "update", "--to-name", "porch"}},
+		{name: "device/update_empty_name", args: []string{"device", "update", "--id", "dev-0001", "--to-name", ""}},
+		{name: "device/delete", args: []string{"device", "delete", "--id", "dev-0002"}},
+		{
+			name:   "device/delete_removes_trackings",
+			args:   []string{"tracking", "list", "-o", "table"},
+			before: [][]string{{"device", "delete", "--id", "dev-0001"}},
+		},
+		{name: "device/delete_missing", args: []string{"device", "delete", "--id", "dev-9999"}},
+		{name: "device/generate", args: []string{"device", "generate", "--id", "dev-0001"}},
+		{name: "device/generate_save", args: []string{"device", "generate", "--id", "dev-0001", "--save"}, show: []string{configFile}},
+		{name: "device/generate_missing", args: []string{"device", "generate", "--id", "dev-9999"}},
+	})
+}
+
+func TestDeviceOptionsRunConcurrently(t *testing.T) {
+	srv := boxeetest.New(boxeetest.WithFixtures(testFixtures()), boxeetest.WithSeed(1))
+	names := []string{"porch", "garage", "shed", "lobby"}
+	outs := make([]bytes.Buffer, len(names))
+	var wg sync.WaitGroup
+	for i, name := range names {
+		o := newDeviceAddOptions(stubDeps(srv, &outs[i]))
+		o.Name, o.Type = name, "side"
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			if err := o.Run(context.Background()); err != nil {
+				t.Errorf("add %v: %v", names[i], err)
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	var out bytes.Buffer
+	o := newDeviceListOptions(stubDeps(srv, &out))
+	o.Limit = boxee.MaxPageSize
+	if err := o.Run(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range names {
+		if !strings.Contains(out.String(), `"name":"`+name+`"`) {
+			t.Errorf("device %v missing from %v", name, out.String())
+		}
+	}
+}
@@ -0,0 +1,94 @@
+package main
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"github.com/epuerta9/box-ee-cli/pkg/boxee"
+	"github.com/spf13/viper"
+	"golang.org/x/term"
+)
+
+// cliEnv is what a run of boxee reads from and writes to. main runs with the
+// process streams and directories, tests inject their own
+type cliEnv struct {
+	Stdin  io.Reader
+	Stdout io.Writer
+	Stderr io.Writer
+	// ConfigDir replaces $XDG_CONFIG_HOME/boxee and WorkDir the working
+	// directory when set. .box-ee.yaml is searched for from WorkDir
+	ConfigDir string
+	WorkDir   string
+	// HTTPClient sends the api requests in place of the client built from the
+	// proxy, tls and timeout settings. Retries, rate limiting and tracing
+	// still apply
+	HTTPClient boxee.HttpRequestDoer
+}
+
+// processEnv is the environment of the boxee process
+func processEnv() *cliEnv {
+	return &cliEnv{Stdin: os.Stdin, Stdout: os.Stdout, Stderr: os.Stderr}
+}
+
+// workPath resolves a relative path against WorkDir
+func (e *cliEnv) workPath(path string) string {
+	if e.WorkDir == "" || filepath.IsAbs(path) {
+		return path
+	}
+	return filepath.Join(e.WorkDir, path)
+}
+
+// terminalIn returns stdin when it is a terminal that can be prompted on
+func (e *cliEnv) terminalIn() (*os.File, bool) {
+	f, ok := e.Stdin.(*os.File)
+	if !ok || !term.IsTerminal(int(f.Fd())) {
+		return nil, false
+	}
+	return f, true
+}
+
+// globalFlags are bound to the persistent flags of the root command
+type globalFlags struct {
+	Output  string
+	Address string
+	Context string
+	Debug   bool
+	Trace   bool
+	Record  string
+	Replay  string
+	// layers holds the transport flags passed on the command line, collected
+	// before the command runs
+	layers []configLayer
+	// parsed is set once cobra accepted the command line and the command
+	// started running. Errors before that are usage errors
+	parsed bool
+}
+
+// runState is everything a run of boxee resolves from its environment, flags
+// and config files. Each run has its own, commands reach it through cmdDeps
+type runState struct {
+	env   *cliEnv
+	flags globalFlags
+	// config holds the layers loaded by the last call to readConfig, viper
+	// their merged settings
+	config *layeredConfig
+	viper  *viper.Viper
+
+	// mu guards the limiter and cassettes shared by every client of the run
+	mu         sync.Mutex
+	limiter    *rateLimiter
+	limiterCfg rateLimitConfig
+	recorder   *recorder
+	replayer   *replayer
+}
+
+func newRunState(env *cliEnv) *runState {
+	return &runState{
+		env:    env,
+		flags:  globalFlags{Output: "json"},
+		config: &layeredConfig{merged: map[string]interface{}{}},
+		viper:  viper.New(),
+	}
+}
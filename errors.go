@@ -0,0 +1,66 @@
+package main
+
+import (
+	"context"
+	"errors"
+
+	"github.com/epuerta9/box-ee-cli/pkg/boxee"
+)
+
+// process exit codes. Keep README.md in sync when adding to this list
+const (
+	ExitOK           = 0
+	ExitError        = 1
+	ExitUsage        = 2
+	ExitBadRequest   = 3
+	ExitUnauthorized = 4
+	ExitForbidden    = 5
+	ExitNotFound     = 6
+	ExitConflict     = 7
+	ExitServerError  = 8
+	ExitClientError  = 9
+	ExitInterrupted  = 130
+)
+
+// usageError marks a mistake in how boxee was called: an unknown command or
+// flag, a wrong number of arguments or flag values that cannot be used
+type usageError struct {
+	err error
+}
+
+func (e usageError) Error() string { return e.err.Error() }
+func (e usageError) Unwrap() error { return e.err }
+
+// isUsageError reports whether err is a usageError
+func isUsageError(err error) bool {
+	var usage usageError
+	return errors.As(err, &usage)
+}
+
+// exitCode maps an error returned by a command to the process exit code
+func exitCode(err error) int {
+	switch {
+	case err == nil:
+		return ExitOK
+	case isUsageError(err):
+		return ExitUsage
+	case errors.Is(err, boxee.ErrBadRequest):
+		return ExitBadRequest
+	case errors.Is(err, boxee.ErrUnauthorized):
+		return ExitUnauthorized
+	case errors.Is(err, boxee.ErrForbidden):
+		return ExitForbidden
+	case errors.Is(err, boxee.ErrNotFound):
+		return ExitNotFound
+	case errors.Is(err, boxee.ErrConflict):
+		return ExitConflict
+	case errors.Is(err, boxee.ErrServer):
+		return ExitServerError
+	case errors.Is(err, boxee.ErrClient):
+		return ExitClientError
+	case errors.Is(err, context.Canceled):
+		return ExitInterrupted
+	default:
+		return ExitError
+	}
+}
@@ -0,0 +1,279 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/epuerta9/box-ee-cli/pkg/boxee"
+	"golang.org/x/term"
+)
+
+var ErrorJournalExists = errors.New("an import journal already exists")
+
+const (
+	importAdded   string = "added"
+	importFailed  string = "failed"
+	importSkipped string = "skipped"
+)
+
+// importResult is the per line report of a bulk tracking import
+type importResult struct {
+	Line           int    `json:"line"`
+	TrackingNumber string `json:"tracking_number"`
+	Status         string `json:"status"`
+	Msg            string `json:"msg,omitempty"`
+}
+
+// importLine is a tracking number read from the import file
+type importLine struct {
+	line           int
+	trackingNumber string
+}
+
+// importJournal records every tracking number the server accepted so an
+// interrupted import can be resumed without sending duplicates
+type importJournal struct {
+	mu sync.Mutex
+	f  *os.File
+}
+
+type journalEntry struct {
+	// DeviceID is empty when the server picked the device
+	DeviceID       string    `json:"device_id,omitempty"`
+	TrackingNumber string    `json:"tracking_number"`
+	Added          time.Time `json:"added"`
+}
+
+// journalKey identifies an imported tracking number. The same number may be
+// imported to another device
+type journalKey struct {
+	deviceID       string
+	trackingNumber string
+}
+
+// openImportJournal opens the journal at path. With resume the existing
+// entries are returned. Otherwise an existing journal is only truncated with
+// force, so a finished or interrupted import is not lost by accident
+func openImportJournal(path string, resume, force bool) (*importJournal, map[journalKey]bool, error) {
+	done := map[journalKey]bool{}
+	flags := os.O_CREATE | os.O_WRONLY | os.O_APPEND
+	if resume {
+		existing, err := os.Open(path)
+		switch {
+		case err == nil:
+			scanner := bufio.NewScanner(existing)
+			for scanner.Scan() {
+				var entry journalEntry
+				//a partially written last line from a crash is ignored
+				if err := json.Unmarshal(scanner.Bytes(), &entry); err == nil {
+					done[journalKey{entry.DeviceID, entry.TrackingNumber}] = true
+				}
+			}
+			existing.Close()
+			if err := scanner.Err(); err != nil {
+				return nil, nil, err
+			}
+		case !errors.Is(err, os.ErrNotExist):
+			return nil, nil, err
+		}
+	} else {
+		if _, err := os.Stat(path); err == nil && !force {
+			return nil, nil, fmt.Errorf("%w: %v. Pass --resume to continue that import or --force to start over", ErrorJournalExists, path)
+		}
+		flags |= os.O_TRUNC
+	}
+	f, err := os.OpenFile(path, flags, 0600)
+	if err != nil {
+		return nil, nil, err
+	}
+	return &importJournal{f: f}, done, nil
+}
+
+func (j *importJournal) record(deviceID, trackingNumber string) error {
+	b, err := json.Marshal(journalEntry{DeviceID: deviceID, TrackingNumber: trackingNumber, Added: time.Now().UTC()})
+	if err != nil {
+		return err
+	}
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	_, err = j.f.Write(append(b, '\n'))
+	return err
+}
+
+func (j *importJournal) Close() error {
+	return j.f.Close()
+}
+
+// readImportFile returns the non blank lines of the import file
+func readImportFile(path string) ([]importLine, error) {
+	readFile, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer readFile.Close()
+
+	var lines []importLine
+	fileScanner := bufio.NewScanner(readFile)
+	for n := 1; fileScanner.Scan(); n++ {
+		tn := strings.TrimSpace(fileScanner.Text())
+		if tn == "" {
+			continue
+		}
+		lines = append(lines, importLine{line: n, trackingNumber: tn})
+	}
+	return lines, fileScanner.Err()
+}
+
+// trackingImporter adds tracking numbers with a pool of workers
+type trackingImporter struct {
+	trackings   *boxee.TrackingsService
+	deviceID    string
+	concurrency int
+	journal     *importJournal
+	progress    io.Writer
+	progressMu  sync.Mutex
+}
+
+// importSummary counts the results of an import by status
+type importSummary struct {
+	added, skipped, failed int
+}
+
+func (s importSummary) total() int {
+	return s.added + s.skipped + s.failed
+}
+
+// run imports lines and hands every result to emit as soon as it is known.
+// emit is never called concurrently. Tracking numbers found in done for the
+// device or repeated in the file are skipped
+func (im *trackingImporter) run(ctx context.Context, lines []importLine, done map[journalKey]bool, emit func(importResult)) importSummary {
+	var summary importSummary
+	report := func(r importResult) {
+		switch r.Status {
+		case importAdded:
+			summary.added++
+		case importSkipped:
+			summary.skipped++
+		default:
+			summary.failed++
+		}
+		emit(r)
+	}
+
+	var pending []importLine
+	seen := map[string]bool{}
+	for _, l := range lines {
+		switch {
+		case done[journalKey{im.deviceID, l.trackingNumber}]:
+			report(importResult{Line: l.line, TrackingNumber: l.trackingNumber, Status: importSkipped, Msg: "already imported"})
+		case seen[l.trackingNumber]:
+			report(importResult{Line: l.line, TrackingNumber: l.trackingNumber, Status: importSkipped, Msg: "duplicate in file"})
+		default:
+			seen[l.trackingNumber] = true
+			pending = append(pending, l)
+		}
+	}
+
+	concurrency := im.concurrency
+	if concurrency < 1 {
+		concurrency = 1
+	}
+	var completed, failed int64
+	total := int64(len(pending))
+	jobs := make(chan importLine)
+	out := make(chan importResult)
+	var wg sync.WaitGroup
+	for i := 0; i < concurrency; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for l := range jobs {
+				r := im.add(ctx, l)
+				if r.Status == importFailed {
+					atomic.AddInt64(&failed, 1)
+				}
+				im.report(atomic.AddInt64(&completed, 1), total, atomic.LoadInt64(&failed))
+				out <- r
+			}
+		}()
+	}
+	go func() {
+		defer close(jobs)
+		for _, l := range pending {
+			select {
+			case jobs <- l:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	go func() {
+		wg.Wait()
+		close(out)
+	}()
+
+	finished := map[int]bool{}
+	for r := range out {
+		finished[r.Line] = true
+		report(r)
+	}
+	//lines never sent because the context was cancelled
+	for _, l := range pending {
+		if !finished[l.line] && ctx.Err() != nil {
+			report(importResult{Line: l.line, TrackingNumber: l.trackingNumber, Status: importFailed, Msg: "not attempted: " + ctx.Err().Error()})
+		}
+	}
+	if im.progress != nil && total > 0 {
+		fmt.Fprintln(im.progress)
+	}
+	return summary
+}
+
+func (im *trackingImporter) add(ctx context.Context, l importLine) importResult {
+	result := importResult{Line: l.line, TrackingNumber: l.trackingNumber, Status: importFailed}
+	added, err := im.trackings.Add(ctx, l.trackingNumber, im.deviceID)
+	switch {
+	case errors.Is(err, boxee.ErrConflict):
+		//the server has the number already, possibly from an earlier attempt
+		//whose response was lost. Journal it so --resume does not send it again
+		result.Status = importSkipped
+		result.Msg = "already on the server"
+	case err != nil:
+		result.Msg = err.Error()
+		return result
+	default:
+		result.Status = importAdded
+		result.Msg = added.Msg
+	}
+	if im.journal != nil {
+		if err := im.journal.record(im.deviceID, l.trackingNumber); err != nil {
+			result.Msg += ", not journaled: " + err.Error()
+		}
+	}
+	return result
+}
+
+func (im *trackingImporter) report(completed, total, failed int64) {
+	if im.progress == nil {
+		return
+	}
+	im.progressMu.Lock()
+	defer im.progressMu.Unlock()
+	fmt.Fprintf(im.progress, "\rimported %d/%d (%d failed)", completed, total, failed)
+}
+
+// isTerminal reports whether the stream s is a file attached to a terminal.
+// Character devices such as /dev/null are not
+func isTerminal(s interface{}) bool {
+	f, ok := s.(*os.File)
+	return ok && term.IsTerminal(int(f.Fd()))
+}
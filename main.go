@@ -1,94 +1,165 @@
 package main
 
 import (
+	"context"
 	"errors"
 	"fmt"
 	"os"
+	"os/signal"
+	"syscall"
 
+	"github.com/epuerta9/box-ee-cli/pkg/boxee"
 	"github.com/spf13/cobra"
-	"github.com/spf13/viper"
 )
 
 var BuildVersion = "development"
 
 const (
-	configFile     string = ".box-ee.yaml"
-	configFileType string = "yaml"
+	configFile string = ".box-ee.yaml"
 )
 
 var (
-	ErrorConfigNotFound = errors.New("config file not found in home directory or current directory. Run boxee init to get started")
-	ErrorEmptyFlag      = errors.New("flag cannot be empty string")
+	ErrorConfigNotFound = errors.New("config file not found in /etc/boxee, $XDG_CONFIG_HOME/boxee or .box-ee.yaml in the current directory or its parents. Run boxee init to get started")
+	ErrorEmptyFlag      = usageError{errors.New("flag cannot be empty string")}
+	ErrorDeviceLookup   = usageError{errors.New("either --id or --name must be set to look up a device")}
 )
 
 func main() {
-	setUpViper()
+	//Ctrl-C cancels the context of the running command, and with it any request
+	//in flight. A second Ctrl-C kills the process
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	go func() {
+		<-ctx.Done()
+		stop()
+	}()
+	code := run(ctx, processEnv(), os.Args[1:])
+	stop()
+	os.Exit(code)
+}
+
+// run executes boxee with args in env and returns the exit code. Every run
+// builds a new command tree and state, so runs in the same process do not
+// share flags or settings
+func run(ctx context.Context, env *cliEnv, args []string) int {
+	deps := newCmdDeps(newRunState(env))
+	stdin := &stdinTracker{Reader: env.Stdin}
+	deps.In = stdin
+	rootCmd := newRootCmd(deps)
+	rootCmd.SetArgs(args)
+	rootCmd.SetIn(env.Stdin)
+	rootCmd.SetOut(env.Stdout)
+	rootCmd.SetErr(env.Stderr)
+
+	cmd, err := rootCmd.ExecuteContextC(ctx)
+	if errors.Is(err, boxee.ErrUnauthorized) && !errors.Is(err, ErrNotLoggedIn) && usesSession(cmd) {
+		err = handleExpiredSession(ctx, deps, cmd, stdin.read)
+	}
+	if err != nil && !deps.state.flags.parsed {
+		err = usageError{err}
+	}
+	if err != nil {
+		fmt.Fprintln(env.Stderr, "Error:", err)
+		if isUsageError(err) {
+			fmt.Fprintf(env.Stderr, "Run '%v --help' for usage.\n", cmd.CommandPath())
+		}
+		return exitCode(err)
+	}
+	return ExitOK
+}
+
+func newRootCmd(deps cmdDeps) *cobra.Command {
 	var rootCmd = &cobra.Command{
 		Use:   "boxee",
 		Short: "Boxee Cli is a cli client for the Box-ee platform api",
 		Long: `
 		To learn more about usage and managing your box-ee account with cli visit the docs on the website
 			`,
+		//run prints errors once to stderr, the usage text only on --help
+		SilenceUsage:  true,
+		SilenceErrors: true,
+	}
+	flags := &deps.state.flags
+	rootCmd.PersistentFlags().StringVarP(&flags.Output, "output", "o", "json", "output format. One of "+outputFormats)
+	rootCmd.PersistentFlags().StringVarP(&flags.Address, "address", "", "", "box-ee server, overrides the config and BOXEE_ADDRESS")
+	rootCmd.PersistentFlags().StringVarP(&flags.Context, "context", "", "", "context to use instead of the current one. Also set by BOXEE_CONTEXT")
+	rootCmd.PersistentFlags().BoolVarP(&flags.Debug, "debug", "", false, "log every api request with its headers, status and timings to stderr")
+	rootCmd.PersistentFlags().BoolVarP(&flags.Trace, "trace", "", false, "like --debug and also log request and response bodies. Secrets are redacted")
+	rootCmd.PersistentFlags().StringVarP(&flags.Record, "record", "", "", "save every api request and response to this directory, with secrets redacted")
+	rootCmd.PersistentFlags().StringVarP(&flags.Replay, "replay", "", "", "answer api requests from a directory saved with --record instead of the server")
+	addTransportFlags(rootCmd)
+	rootCmd.PersistentPreRunE = func(cmd *cobra.Command, args []string) error {
+		if flags.Record != "" && flags.Replay != "" {
+			return ErrorRecordAndReplay
+		}
+		if _, err := newPrinter(flags.Output); err != nil {
+			return err
+		}
+		return deps.state.collectFlagLayers(cmd)
 	}
 	//registering all subcommands
-	rootCmd.AddCommand(getInitCommand())
-	rootCmd.AddCommand(getDeviceCmd())
-	rootCmd.AddCommand(getTrackingCmd())
-	rootCmd.AddCommand(getLoginCmd())
-	rootCmd.AddCommand(getRegisterCmd())
-	rootCmd.AddCommand(getRecoverCmd())
-	rootCmd.AddCommand(versionCmd())
-
-	if err := rootCmd.Execute(); err != nil {
-		fmt.Println(err)
-		os.Exit(1)
+	rootCmd.AddCommand(getInitCommand(deps))
+	rootCmd.AddCommand(getConfigCmd(deps))
+	rootCmd.AddCommand(getDeviceCmd(deps))
+	rootCmd.AddCommand(getTrackingCmd(deps))
+	rootCmd.AddCommand(getPinCmd(deps))
+	rootCmd.AddCommand(getLoginCmd(deps))
+	rootCmd.AddCommand(getRegisterCmd(deps))
+	rootCmd.AddCommand(getRecoverCmd(deps))
+	rootCmd.AddCommand(getWhoamiCmd(deps))
+	rootCmd.AddCommand(getLogoutCmd(deps))
+	rootCmd.AddCommand(getCredentialsCmd(deps))
+	rootCmd.AddCommand(getDevCmd(deps))
+	rootCmd.AddCommand(versionCmd(deps))
+	markParsed(rootCmd, &flags.parsed)
+	return rootCmd
+}
+
+// markParsed sets parsed when a command of the tree starts running. cobra
+// checks arguments and required flags before that, so any earlier error is
+// a usage error
+func markParsed(cmd *cobra.Command, parsed *bool) {
+	if runE := cmd.RunE; runE != nil {
+		cmd.RunE = func(cmd *cobra.Command, args []string) error {
+			*parsed = true
+			return runE(cmd, args)
+		}
+	}
+	for _, c := range cmd.Commands() {
+		markParsed(c, parsed)
 	}
 }
 
-func setUpViper() {
-	viper.SetConfigName(configFile)
-	viper.SetConfigFile(configFile)
-	viper.SetConfigType(configFileType)
-	viper.AddConfigPath(".")
+// versionOptions are the options of boxee version
+type versionOptions struct {
+	cmdDeps
 }
 
-func versionCmd() *cobra.Command {
+func newVersionOptions(deps cmdDeps) *versionOptions {
+	return &versionOptions{cmdDeps: deps}
+}
+
+func (o *versionOptions) Run(ctx context.Context) error {
+	version := os.Getenv("VERSION")
+	if version == "" {
+		version = "0.0.1-beta"
+	}
+	fmt.Fprintln(o.Out, version)
+	return nil
+}
+
+func versionCmd(deps cmdDeps) *cobra.Command {
+	o := newVersionOptions(deps)
 	return &cobra.Command{
 		Use:   "version",
 		Short: "version of tool",
 		Long: `
 		check the current version of box-ee's boxee cli `,
 		RunE: func(cmd *cobra.Command, args []string) error {
-			version := os.Getenv("VERSION")
-			if version == "" {
-				version = "0.0.1-beta"
-			}
-
-			fmt.Println(version)
-			return nil
+			return o.Run(cmd.Context())
 		},
 	}
 }
 
-func readConfig() error {
-	file, err := os.Open(fmt.Sprintf("%v", configFile))
-	if err != nil {
-		return err
-	}
-	if err := viper.ReadConfig(file); err != nil {
-		if _, ok := err.(viper.ConfigFileNotFoundError); ok {
-			//config file was not found
-			return ErrorConfigNotFound
-
-		} else {
-			// Config file was found but another error was produced
-			return err
-		}
-	}
-	return nil
-
-}
-
 func CheckEmptyFlag(flag string) error {
 	if flag == "" {
 		return ErrorEmptyFlag
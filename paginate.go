@@ -0,0 +1,129 @@
+package main
+
+import (
+	"context"
+	"encoding/csv"
+	"fmt"
+	"io"
+	"reflect"
+	"strings"
+
+	"github.com/epuerta9/box-ee-cli/pkg/boxee"
+)
+
+// streamPages drains the iterator and renders each page as soon as it arrives.
+// json output becomes NDJSON, yaml output a multi document stream and the
+// table formats print their header once
+func streamPages[T any](ctx context.Context, w io.Writer, format string, it *boxee.Iterator[T]) error {
+	s, err := newListStreamer(w, format)
+	if err != nil {
+		return err
+	}
+	for it.Next(ctx) {
+		if err := s.Page(it.Page()); err != nil {
+			return err
+		}
+	}
+	if err := it.Err(); err != nil {
+		return err
+	}
+	return s.Done([]T{})
+}
+
+// listStreamer renders a list incrementally, one page at a time
+type listStreamer struct {
+	w      io.Writer
+	p      printer
+	items  int
+	widths []int
+	// headed is set once the table or csv header is written
+	headed bool
+}
+
+func newListStreamer(w io.Writer, format string) (*listStreamer, error) {
+	p, err := newPrinter(format)
+	if err != nil {
+		return nil, err
+	}
+	return &listStreamer{w: w, p: p}, nil
+}
+
+// Page renders a slice of items
+func (s *listStreamer) Page(items interface{}) error {
+	switch p := s.p.(type) {
+	case tablePrinter:
+		//column widths are fixed by the header and the first page so later
+		//pages line up without buffering the whole list
+		headers, rows := tableRows(items, p.wide)
+		if !s.headed {
+			s.widths = make([]int, len(headers))
+			for _, r := range append([][]string{headers}, rows...) {
+				for i, c := range r {
+					if i < len(s.widths) && len(c) > s.widths[i] {
+						s.widths[i] = len(c)
+					}
+				}
+			}
+			s.writeRow(headers)
+			s.headed = true
+		}
+		for _, r := range rows {
+			s.writeRow(r)
+		}
+		s.items += len(rows)
+		return nil
+	case csvPrinter:
+		headers, rows := tableRows(items, true)
+		cw := csv.NewWriter(s.w)
+		if !s.headed {
+			if err := cw.Write(headers); err != nil {
+				return err
+			}
+			s.headed = true
+		}
+		s.items += len(rows)
+		return cw.WriteAll(rows)
+	}
+
+	rv := reflect.ValueOf(items)
+	for i := 0; i < rv.Len(); i++ {
+		if _, ok := s.p.(yamlPrinter); ok && s.items > 0 {
+			fmt.Fprintln(s.w, "---")
+		}
+		if err := s.p.Print(s.w, rv.Index(i).Interface()); err != nil {
+			return err
+		}
+		s.items++
+	}
+	return nil
+}
+
+// Done ends the list. A table or csv list without any page still gets its
+// header from empty, an empty slice of the item type, like the output of a
+// single page list
+func (s *listStreamer) Done(empty interface{}) error {
+	switch s.p.(type) {
+	case tablePrinter, csvPrinter:
+		if !s.headed {
+			return s.Page(empty)
+		}
+	}
+	return nil
+}
+
+func (s *listStreamer) writeRow(row []string) {
+	var line strings.Builder
+	for i, c := range row {
+		if i == len(row)-1 {
+			line.WriteString(c)
+			break
+		}
+		line.WriteString(c)
+		if pad := s.widths[i] - len(c) + 3; pad > 0 {
+			line.WriteString(strings.Repeat(" ", pad))
+		} else {
+			line.WriteString(" ")
+		}
+	}
+	fmt.Fprintln(s.w, strings.TrimRight(line.String(), " "))
+}
@@ -0,0 +1,161 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/epuerta9/box-ee-cli/pkg/boxee"
+	"github.com/spf13/cobra"
+)
+
+var (
+	ErrorClientKeyNotSet = errors.New("client key not set. Pass --client-key, set BOXEE_CLIENT_KEY or run boxee device generate --save")
+	ErrorNoPinKeys       = errors.New("no pin keys given. Pass them as arguments, with --file or on stdin")
+	ErrorPinInvalid      = errors.New("one or more pin keys are invalid")
+)
+
+func getPinCmd(deps cmdDeps) *cobra.Command {
+	//pin root command. Hang all sub commands related to pin keys off of this one
+	pinCmd := &cobra.Command{
+		Use:   "pin",
+		Short: "pin key actions command",
+		Long: `
+			The root command for pin keys. Possible subcommands include validate`,
+	}
+
+	pinCmd.AddCommand(pinValidate(deps))
+	return pinCmd
+}
+
+// pinValidateOptions are the options of boxee pin validate
+type pinValidateOptions struct {
+	cmdDeps
+	// ClientKey falls back to BOXEE_CLIENT_KEY and then the key saved by
+	// boxee device generate --save
+	ClientKey string
+	File      string
+	// PinKeys are the arguments. "-" or no pin keys and no file read stdin
+	PinKeys []string
+}
+
+func newPinValidateOptions(deps cmdDeps) *pinValidateOptions {
+	return &pinValidateOptions{cmdDeps: deps}
+}
+
+func (o *pinValidateOptions) Run(ctx context.Context) error {
+	cParams, err := o.Config()
+	if err != nil {
+		return err
+	}
+	clientKey := o.ClientKey
+	//BOXEE_CLIENT_KEY comes in through the env layer, a client_key in a
+	//config file is a legacy plaintext key left to readCredential
+	if clientKey == "" && o.state.config.overridden("client_key") {
+		clientKey = o.state.viper.GetString("client_key")
+	}
+	if clientKey == "" {
+		clientKey, err = o.state.readCredential(cParams, credClientKey)
+		if err != nil {
+			return err
+		}
+	}
+	if clientKey == "" {
+		return ErrorClientKeyNotSet
+	}
+
+	pinKeys, err := collectPinKeys(o.state.env, o.PinKeys, o.File, o.In)
+	if err != nil {
+		return err
+	}
+	if len(pinKeys) == 0 {
+		return ErrorNoPinKeys
+	}
+
+	api, err := o.Clients.Client(cParams, boxee.WithClientKey(clientKey))
+	if err != nil {
+		return err
+	}
+
+	allValid := true
+	var results []boxee.PinValidation
+	for _, pk := range pinKeys {
+		result, err := api.Pins.Validate(ctx, pk)
+		if err != nil {
+			return err
+		}
+		if !result.Valid {
+			allValid = false
+		}
+		results = append(results, *result)
+	}
+	if err := o.print(results); err != nil {
+		return err
+	}
+	if !allValid {
+		return ErrorPinInvalid
+	}
+	return nil
+}
+
+func pinValidate(deps cmdDeps) *cobra.Command {
+	o := newPinValidateOptions(deps)
+	pinValidateCmd := &cobra.Command{
+		Use:   "validate [pin-key...]",
+		Short: "validate pin keys",
+		Long: `
+		validate one or many pin keys against the box-ee server. Pin keys are read from the arguments,
+		from --file or from stdin when no arguments are given or the single argument is "-".
+		Authentication uses the device client key from boxee device generate. The command exits
+		non-zero when any pin key is invalid`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			o.PinKeys = args
+			return o.Run(cmd.Context())
+		},
+	}
+	pinValidateCmd.Flags().StringVarP(&o.ClientKey, "client-key", "k", "", "device client key used to authenticate")
+	pinValidateCmd.Flags().StringVarP(&o.File, "file", "f", "", "file with one pin key per line")
+	return pinValidateCmd
+}
+
+// collectPinKeys gathers pin keys from the arguments, a file relative to the
+// work dir of env and stdin
+func collectPinKeys(env *cliEnv, args []string, pinFile string, stdin io.Reader) ([]string, error) {
+	var pinKeys []string
+	readFromStdin := len(args) == 0 && pinFile == ""
+	for _, a := range args {
+		if a == "-" {
+			readFromStdin = true
+			continue
+		}
+		pinKeys = append(pinKeys, a)
+	}
+	if pinFile != "" {
+		readFile, err := os.Open(env.workPath(pinFile))
+		if err != nil {
+			return nil, err
+		}
+		defer readFile.Close()
+		pinKeys = append(pinKeys, scanLines(readFile)...)
+	}
+	if readFromStdin {
+		pinKeys = append(pinKeys, scanLines(stdin)...)
+	}
+	return pinKeys, nil
+}
+
+// scanLines returns the non blank lines of r with surrounding whitespace trimmed
+func scanLines(r io.Reader) []string {
+	var lines []string
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line != "" {
+			lines = append(lines, line)
+		}
+	}
+	return lines
+}
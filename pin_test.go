@@ -0,0 +1,34 @@
+package main
+
+import (
+	"testing"
+)
+
+func TestPinCommands(t *testing.T) {
+	runCLICases(t, []cliCase{
+		{name: "pin/validate", args: []string{"pin", "validate", "--client-key", "ck_locker", "111111", "222222"}},
+		{name: "pin/validate_invalid", args: []string{"pin", "validate", "--client-key", "ck_locker", "111111", "999999", "12ab", "-o", "table"}},
+		{name: "pin/validate_other_device", args: []string{"pin", "validate", "--client-key", "ck_locker", "333333"}},
+		{name: "pin/validate_stdin", args: []string{"pin", "validate", "--client-key", "ck_locker"}, stdin: "111111\n\n  222222  \n"},
+		{
+			name:  "pin/validate_file_and_args",
+			args:  []string{"pin", "validate", "--client-key", "ck_locker", "--file", "pins.txt", "111111"},
+			files: map[string]string{"pins.txt": "222222\n"},
+		},
+		{name: "pin/validate_env_key", args: []string{"pin", "validate", "111111"}, env: map[string]string{"BOXEE_CLIENT_KEY": "ck_locker"}},
+		{
+			name:   "pin/validate_saved_key",
+			args:   []string{"pin", "validate", "111111", "333333"},
+			before: [][]string{{"device", "generate", "--save"}},
+		},
+		{
+			name:   "pin/validate_env_key_over_saved",
+			args:   []string{"pin", "validate", "333333"},
+			env:    map[string]string{"BOXEE_CLIENT_KEY": "ck_locker"},
+			before: [][]string{{"device", "generate", "--save"}},
+		},
+		{name: "pin/validate_no_key", args: []string{"pin", "validate", "111111"}},
+		{name: "pin/validate_bad_key", args: []string{"pin", "validate", "--client-key", "ck_nope", "111111"}},
+		{name: "pin/validate_no_pins", args: []string{"pin", "validate", "--client-key", "ck_locker"}},
+	})
+}
@@ -0,0 +1,89 @@
+package boxee
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// AuthService logs in, registers accounts and starts password recovery. None
+// of its calls need a session token
+type AuthService struct {
+	client *ClientWithResponses
+}
+
+// Login returns the session token for email. Wrong credentials return
+// ErrInvalidCredentials and a locked account ErrAccountLocked, both with the
+// message of the server. Throttled logins (429) are a plain APIError
+func (s *AuthService) Login(ctx context.Context, email, password string) (*AdminLoginResponseItem, error) {
+	resp, err := s.client.AdminLoginWithResponse(ctx, AdminLoginRequest{
+		Email:    email,
+		Password: password,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("login request failed: %w", err)
+	}
+	switch resp.StatusCode() {
+	case http.StatusOK:
+	case http.StatusBadRequest, http.StatusUnauthorized:
+		return nil, withServerMsg(ErrInvalidCredentials, resp.StatusCode(), resp.Body)
+	case http.StatusLocked:
+		return nil, withServerMsg(ErrAccountLocked, resp.StatusCode(), resp.Body)
+	case http.StatusForbidden:
+		if apiErr := ParseAPIError(resp.StatusCode(), resp.Body); strings.Contains(strings.ToLower(apiErr.Msg), "lock") {
+			return nil, withServerMsg(ErrAccountLocked, resp.StatusCode(), resp.Body)
+		}
+		return nil, CheckResponse(resp.StatusCode(), resp.Body)
+	default:
+		if err := CheckResponse(resp.StatusCode(), resp.Body); err != nil {
+			return nil, err
+		}
+		return nil, unexpectedResponse(resp.Status())
+	}
+	login := resp.JSON200
+	if login == nil {
+		return nil, unexpectedResponse(resp.Status())
+	}
+	if login.StatusCode != 0 && (login.StatusCode < 200 || login.StatusCode > 299) {
+		return nil, fmt.Errorf("login rejected with status_code %d: %v", login.StatusCode, login.Msg)
+	}
+	if strings.TrimSpace(login.SessionToken) == "" {
+		return nil, ErrEmptySessionToken
+	}
+	return login, nil
+}
+
+// Register creates an account
+func (s *AuthService) Register(ctx context.Context, email, password string) (*AdminRegisterResponseItem, error) {
+	resp, err := s.client.AdminRegisterWithResponse(ctx, AdminLoginRequest{
+		Email:    email,
+		Password: password,
+	})
+	if err != nil {
+		return nil, err
+	}
+	if err := CheckResponse(resp.StatusCode(), resp.Body); err != nil {
+		return nil, err
+	}
+	if resp.JSON200 == nil {
+		return nil, unexpectedResponse(resp.Status())
+	}
+	return resp.JSON200, nil
+}
+
+// Recover sends a password recovery email. The server answers the same
+// whether the account exists or not
+func (s *AuthService) Recover(ctx context.Context, email string) (*StandardResponse, error) {
+	resp, err := s.client.AdminRecoverWithResponse(ctx, AdminRecoverRequest{Email: email})
+	if err != nil {
+		return nil, err
+	}
+	if err := CheckResponse(resp.StatusCode(), resp.Body); err != nil {
+		return nil, err
+	}
+	if resp.JSON200 == nil {
+		return nil, unexpectedResponse(resp.Status())
+	}
+	return resp.JSON200, nil
+}
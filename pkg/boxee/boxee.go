@@ -0,0 +1,82 @@
+package boxee
+
+import (
+	"context"
+	"net/http"
+)
+
+const (
+	// SessionHeader carries the session token from a login
+	SessionHeader = "X-Boxee-Auth"
+	// ClientKeyHeader carries a device client key from Devices.GenerateKey,
+	// it is the header of the clientApiKey security scheme of the spec
+	// (ClientApiKeyScopes)
+	ClientKeyHeader = "clientApiKey"
+)
+
+// DefaultServer is the address of the hosted box-ee api
+const DefaultServer = "https://api.box-ee.com"
+
+// API is a typed client for the box-ee api grouped by resource. Devices,
+// Trackings and account management need WithSessionToken, Pins needs
+// WithClientKey and Auth works without either
+type API struct {
+	Devices   *DevicesService
+	Trackings *TrackingsService
+	Auth      *AuthService
+	Pins      *PinsService
+
+	client *ClientWithResponses
+}
+
+// New returns an API for server. opts are the options of the generated
+// client such as WithHTTPClient and WithRequestEditorFn, together with
+// WithSessionToken and WithClientKey
+func New(server string, opts ...ClientOption) (*API, error) {
+	opts = append([]ClientOption{WithRequestEditorFn(jsonContentType)}, opts...)
+	client, err := NewClientWithResponses(server, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return &API{
+		Devices:   &DevicesService{client: client},
+		Trackings: &TrackingsService{client: client},
+		Auth:      &AuthService{client: client},
+		Pins:      &PinsService{client: client},
+		client:    client,
+	}, nil
+}
+
+// Raw returns the generated client the API is built on
+func (a *API) Raw() *ClientWithResponses {
+	return a.client
+}
+
+// WithSessionToken authenticates requests with a session token from
+// Auth.Login
+func WithSessionToken(token string) ClientOption {
+	return WithRequestEditorFn(func(ctx context.Context, req *http.Request) error {
+		if token == "" {
+			return ErrNoSessionToken
+		}
+		req.Header.Set(SessionHeader, token)
+		return nil
+	})
+}
+
+// WithClientKey authenticates requests with a device client key, which is
+// what Pins.Validate needs
+func WithClientKey(key string) ClientOption {
+	return WithRequestEditorFn(func(ctx context.Context, req *http.Request) error {
+		if key == "" {
+			return ErrNoClientKey
+		}
+		req.Header.Set(ClientKeyHeader, key)
+		return nil
+	})
+}
+
+func jsonContentType(ctx context.Context, req *http.Request) error {
+	req.Header.Set("Content-Type", "application/json")
+	return nil
+}
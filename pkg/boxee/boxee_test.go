@@ -0,0 +1,248 @@
+package boxee_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/epuerta9/box-ee-cli/pkg/boxee"
+	"github.com/epuerta9/box-ee-cli/pkg/boxeetest"
+)
+
+func testFixtures() boxeetest.Fixtures {
+	f := boxeetest.Fixtures{
+		Users: []boxeetest.UserFixture{{Email: "qa@example.com", Password: "Quiet-Harbor-52", SessionToken: "sess_qa"}},
+		Devices: []boxeetest.DeviceFixture{{
+			ID:        "dev-0001",
+			Name:      "front-porch",
+			Type:      "main",
+			Health:    1,
+			ClientKey: "ck_qa",
+			Trackings: []boxeetest.TrackingFixture{{ID: "trk-0001", TrackingNumber: "1Z999AA10123456784", PinKey: "123456"}},
+		}},
+	}
+	//enough devices to span several pages
+	for i := 2; i <= 25; i++ {
+		f.Devices = append(f.Devices, boxeetest.DeviceFixture{ID: fmt.Sprintf("dev-%04d", i), Name: fmt.Sprintf("shed-%d", i), Type: "side"})
+	}
+	return f
+}
+
+// newTestAPI returns an API for a fake server with testFixtures
+func newTestAPI(t *testing.T, opts ...boxee.ClientOption) (*boxee.API, *boxeetest.Server) {
+	t.Helper()
+	srv := boxeetest.New(boxeetest.WithFixtures(testFixtures()), boxeetest.WithSeed(1))
+	ts := httptest.NewServer(srv)
+	t.Cleanup(ts.Close)
+	api, err := boxee.New(ts.URL, opts...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return api, srv
+}
+
+func TestDevices(t *testing.T) {
+	ctx := context.Background()
+	api, _ := newTestAPI(t, boxee.WithSessionToken("sess_qa"))
+
+	page, err := api.Devices.List(ctx, boxee.ListOptions{Page: 2, Limit: 10})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if page.Count != 25 || len(page.Devices) != 10 {
+		t.Fatalf("page 2 has %d of %d devices, want 10 of 25", len(page.Devices), page.Count)
+	}
+
+	all, err := api.Devices.Iter(boxee.IterOptions{Limit: 7}).All(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(all) != 25 {
+		t.Fatalf("iterated %d devices, want 25", len(all))
+	}
+
+	created, err := api.Devices.Add(ctx, "garage", "side")
+	if err != nil {
+		t.Fatal(err)
+	}
+	id, err := api.Devices.ResolveID(ctx, "garage")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if id != created.DeviceId {
+		t.Fatalf("resolved id %v, want %v", id, created.DeviceId)
+	}
+	if _, err := api.Devices.Update(ctx, id, "carport"); err != nil {
+		t.Fatal(err)
+	}
+	found, err := api.Devices.Get(ctx, boxee.DeviceQuery{Name: "carport"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(found) != 1 || found[0].Name != "carport" {
+		t.Fatalf("get carport returned %+v", found)
+	}
+	key, err := api.Devices.GenerateKey(ctx, id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if key.ClientKey == "" {
+		t.Fatal("generated an empty client key")
+	}
+	if _, err := api.Devices.Delete(ctx, id); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := api.Devices.ResolveID(ctx, "garage"); !errors.Is(err, boxee.ErrNotFound) {
+		t.Fatalf("resolving a deleted device returned %v, want ErrNotFound", err)
+	}
+	if _, err := api.Devices.Get(ctx, boxee.DeviceQuery{}); !errors.Is(err, boxee.ErrDeviceQuery) {
+		t.Fatalf("get without a query returned %v, want ErrDeviceQuery", err)
+	}
+	var apiErr *boxee.APIError
+	if _, err := api.Devices.Delete(ctx, "dev-9999"); !errors.As(err, &apiErr) || apiErr.StatusCode != http.StatusNotFound {
+		t.Fatalf("delete of a missing device returned %v, want a 404 APIError", err)
+	}
+}
+
+func TestTrackings(t *testing.T) {
+	ctx := context.Background()
+	api, _ := newTestAPI(t, boxee.WithSessionToken("sess_qa"))
+
+	if _, err := api.Trackings.Add(ctx, "1Z999AA10123456785", "dev-0001"); err != nil {
+		t.Fatal(err)
+	}
+	list, err := api.Trackings.List(ctx, "dev-0001", boxee.ListOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if list.Count != 2 {
+		t.Fatalf("device has %d trackings, want 2", list.Count)
+	}
+	got, err := api.Trackings.Get(ctx, "1Z999AA10123456785", "dev-0001")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.PinKey == "" {
+		t.Fatal("tracking has no pin key")
+	}
+	if _, err := api.Trackings.Delete(ctx, got.Id); err != nil {
+		t.Fatal(err)
+	}
+	_, err = api.Trackings.Get(ctx, "1Z999AA10123456785", "dev-0001")
+	if !errors.Is(err, boxee.ErrNotFound) {
+		t.Fatalf("get of a deleted tracking returned %v, want ErrNotFound", err)
+	}
+
+	it := api.Trackings.Iter("", boxee.IterOptions{MaxItems: 1})
+	items, err := it.All(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(items) != 1 || items[0].TrackingNumber != "1Z999AA10123456784" {
+		t.Fatalf("iterated %+v, want the fixture tracking", items)
+	}
+}
+
+func TestAuth(t *testing.T) {
+	ctx := context.Background()
+	api, _ := newTestAPI(t)
+
+	login, err := api.Auth.Login(ctx, "qa@example.com", "Quiet-Harbor-52")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if login.SessionToken == "" {
+		t.Fatal("login returned no session token")
+	}
+	if _, err := api.Auth.Login(ctx, "qa@example.com", "wrong"); !errors.Is(err, boxee.ErrInvalidCredentials) {
+		t.Fatalf("login with a wrong password returned %v, want ErrInvalidCredentials", err)
+	}
+	if _, err := api.Auth.Register(ctx, "new@example.com", "Amber-Lantern-81"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := api.Auth.Recover(ctx, "new@example.com"); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := api.Devices.List(ctx, boxee.ListOptions{}); !errors.Is(err, boxee.ErrUnauthorized) {
+		t.Fatalf("list without a session returned %v, want ErrUnauthorized", err)
+	}
+	empty, _ := newTestAPI(t, boxee.WithSessionToken(""))
+	if _, err := empty.Devices.List(ctx, boxee.ListOptions{}); !errors.Is(err, boxee.ErrNoSessionToken) {
+		t.Fatalf("list with an empty token returned %v, want ErrNoSessionToken", err)
+	}
+}
+
+func TestPinsValidate(t *testing.T) {
+	ctx := context.Background()
+	api, _ := newTestAPI(t, boxee.WithClientKey("ck_qa"))
+
+	cases := []struct {
+		pinKey string
+		valid  bool
+	}{
+		{"123456", true},
+		{"654321", false},
+		{"12ab", false},
+	}
+	for _, c := range cases {
+		got, err := api.Pins.Validate(ctx, c.pinKey)
+		if err != nil {
+			t.Fatalf("validate %v: %v", c.pinKey, err)
+		}
+		if got.Valid != c.valid || got.PinKey != c.pinKey {
+			t.Errorf("validate %v returned %+v, want valid %v", c.pinKey, got, c.valid)
+		}
+	}
+
+	wrongKey, _ := newTestAPI(t, boxee.WithClientKey("ck_nope"))
+	if _, err := wrongKey.Pins.Validate(ctx, "123456"); !errors.Is(err, boxee.ErrUnauthorized) {
+		t.Fatalf("validate with an unknown client key returned %v, want ErrUnauthorized", err)
+	}
+}
+
+func TestAPIErrorClasses(t *testing.T) {
+	cases := []struct {
+		status int
+		class  error
+	}{
+		{http.StatusBadRequest, boxee.ErrBadRequest},
+		{http.StatusUnauthorized, boxee.ErrUnauthorized},
+		{http.StatusForbidden, boxee.ErrForbidden},
+		{http.StatusNotFound, boxee.ErrNotFound},
+		{http.StatusConflict, boxee.ErrConflict},
+		{http.StatusBadGateway, boxee.ErrServer},
+		{http.StatusTooManyRequests, boxee.ErrClient},
+		{http.StatusTeapot, boxee.ErrClient},
+	}
+	for _, c := range cases {
+		err := boxee.CheckResponse(c.status, []byte(`{"msg":"nope","status_code":0}`))
+		if !errors.Is(err, c.class) {
+			t.Errorf("status %d returned %v, want %v", c.status, err, c.class)
+		}
+	}
+	if err := boxee.CheckResponse(http.StatusNoContent, nil); err != nil {
+		t.Errorf("status 204 returned %v", err)
+	}
+}
+
+func ExampleNew() {
+	ctx := context.Background()
+	api, err := boxee.New(boxee.DefaultServer, boxee.WithSessionToken("sess_..."))
+	if err != nil {
+		return
+	}
+	it := api.Devices.Iter(boxee.IterOptions{})
+	for it.Next(ctx) {
+		for _, d := range it.Page() {
+			fmt.Println(d.Id, d.Name)
+		}
+	}
+	if err := it.Err(); errors.Is(err, boxee.ErrUnauthorized) {
+		fmt.Println("log in again")
+	}
+}
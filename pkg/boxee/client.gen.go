@@ -1,7 +1,7 @@
-// Package main provides primitives to interact with the openapi HTTP API.
+// Package boxee provides primitives to interact with the openapi HTTP API.
 //
 // Code generated by github.com/deepmap/oapi-codegen version v1.11.0 DO NOT EDIT.
-package main
+package boxee
 
 import (
 	"bytes"
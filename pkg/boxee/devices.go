@@ -0,0 +1,162 @@
+package boxee
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+)
+
+// DevicesService manages the devices of the logged in account
+type DevicesService struct {
+	client *ClientWithResponses
+}
+
+// DeviceQuery selects devices by id, by name or by both
+type DeviceQuery struct {
+	ID   string
+	Name string
+}
+
+// List returns a page of devices
+func (s *DevicesService) List(ctx context.Context, opts ListOptions) (*ListDevices, error) {
+	page, limit := opts.params()
+	resp, err := s.client.ListDevicesWithResponse(ctx, &ListDevicesParams{Page: page, Limit: limit})
+	if err != nil {
+		return nil, err
+	}
+	if err := CheckResponse(resp.StatusCode(), resp.Body); err != nil {
+		return nil, err
+	}
+	if resp.JSON200 == nil {
+		return nil, unexpectedResponse(resp.Status())
+	}
+	return resp.JSON200, nil
+}
+
+// Iter returns an iterator over every device
+func (s *DevicesService) Iter(opts IterOptions) *Iterator[DeviceObjectModel] {
+	return NewIterator(func(ctx context.Context, page, limit int) ([]DeviceObjectModel, int, error) {
+		list, err := s.List(ctx, ListOptions{Page: page, Limit: limit})
+		if err != nil {
+			return nil, 0, err
+		}
+		return list.Devices, list.Count, nil
+	}, opts)
+}
+
+// Get returns the devices matching q. No match is an APIError with
+// ErrNotFound
+func (s *DevicesService) Get(ctx context.Context, q DeviceQuery) ([]DeviceGetResponse, error) {
+	if q.ID == "" && q.Name == "" {
+		return nil, ErrDeviceQuery
+	}
+	var params FindDeviceParams
+	if q.ID != "" {
+		params.DeviceId = &q.ID
+	}
+	if q.Name != "" {
+		params.DeviceName = &q.Name
+	}
+	resp, err := s.client.FindDeviceWithResponse(ctx, &params)
+	if err != nil {
+		return nil, err
+	}
+	if err := CheckResponse(resp.StatusCode(), resp.Body); err != nil {
+		return nil, err
+	}
+	if resp.JSON200 == nil {
+		return nil, unexpectedResponse(resp.Status())
+	}
+	if len(*resp.JSON200) == 0 {
+		return nil, NewAPIError(http.StatusNotFound, "no device matched")
+	}
+	return *resp.JSON200, nil
+}
+
+// ResolveID returns the id of the device called name. Get does not return
+// device ids so the device list is paged through instead
+func (s *DevicesService) ResolveID(ctx context.Context, name string) (string, error) {
+	it := s.Iter(IterOptions{})
+	for it.Next(ctx) {
+		for _, d := range it.Page() {
+			if d.Name == name {
+				return d.Id, nil
+			}
+		}
+	}
+	if err := it.Err(); err != nil {
+		return "", err
+	}
+	return "", NewAPIError(http.StatusNotFound, fmt.Sprintf("device %v not found", name))
+}
+
+// Add creates a device
+func (s *DevicesService) Add(ctx context.Context, name, deviceType string) (*DeviceCreatedResponse, error) {
+	resp, err := s.client.AddDeviceWithResponse(ctx, DeviceRequestAdd{
+		DeviceName: name,
+		DeviceType: deviceType,
+	})
+	if err != nil {
+		return nil, err
+	}
+	if err := CheckResponse(resp.StatusCode(), resp.Body); err != nil {
+		return nil, err
+	}
+	if resp.JSON201 == nil {
+		return nil, unexpectedResponse(resp.Status())
+	}
+	return resp.JSON201, nil
+}
+
+// Update renames the device with id
+func (s *DevicesService) Update(ctx context.Context, id, toName string) (*DeviceStandardResponse, error) {
+	resp, err := s.client.UpdateDeviceWithResponse(ctx, DeviceRequestPatch{
+		DeviceId: id,
+		ToName:   toName,
+	})
+	if err != nil {
+		return nil, err
+	}
+	if err := CheckResponse(resp.StatusCode(), resp.Body); err != nil {
+		return nil, err
+	}
+	if resp.JSON200 == nil {
+		return nil, unexpectedResponse(resp.Status())
+	}
+	return resp.JSON200, nil
+}
+
+// Delete removes the device with id together with its trackings
+func (s *DevicesService) Delete(ctx context.Context, id string) (*DeviceCreatedResponse, error) {
+	resp, err := s.client.DeleteDeviceWithResponse(ctx, &DeleteDeviceParams{DeviceId: id})
+	if err != nil {
+		return nil, err
+	}
+	if err := CheckResponse(resp.StatusCode(), resp.Body); err != nil {
+		return nil, err
+	}
+	if resp.JSON200 == nil {
+		return nil, unexpectedResponse(resp.Status())
+	}
+	return resp.JSON200, nil
+}
+
+// GenerateKey creates a client key for the device with id, or for the
+// account when id is empty. The key authenticates Pins.Validate
+func (s *DevicesService) GenerateKey(ctx context.Context, id string) (*DeviceKeyGenResponse, error) {
+	var request DeviceRequestKeyGen
+	if id != "" {
+		request.DeviceId = &id
+	}
+	resp, err := s.client.GenKeyWithResponse(ctx, request)
+	if err != nil {
+		return nil, err
+	}
+	if err := CheckResponse(resp.StatusCode(), resp.Body); err != nil {
+		return nil, err
+	}
+	if resp.JSON201 == nil {
+		return nil, unexpectedResponse(resp.Status())
+	}
+	return resp.JSON201, nil
+}
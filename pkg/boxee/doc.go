@@ -0,0 +1,35 @@
+/*
+Package boxee is a Go client for the box-ee api, the same one the boxee cli is
+built on.
+
+	api, err := boxee.New(boxee.DefaultServer)
+	if err != nil {
+		...
+	}
+	login, err := api.Auth.Login(ctx, "me@example.com", password)
+	if err != nil {
+		...
+	}
+	api, err = boxee.New(boxee.DefaultServer, boxee.WithSessionToken(login.SessionToken))
+	if err != nil {
+		...
+	}
+	it := api.Trackings.Iter("", boxee.IterOptions{})
+	for it.Next(ctx) {
+		for _, t := range it.Page() {
+			fmt.Println(t.TrackingNumber, t.PinKey)
+		}
+	}
+	if err := it.Err(); err != nil {
+		...
+	}
+
+Every non 2xx response is returned as an *APIError, which unwraps to one of
+ErrBadRequest, ErrUnauthorized, ErrForbidden, ErrNotFound, ErrConflict,
+ErrServer or ErrClient.
+
+The generated client the API is built on is exported as well, see Raw.
+Requests go through http.DefaultClient unless WithHTTPClient is passed.
+Retries, rate limiting and tracing are left to that client.
+*/
+package boxee
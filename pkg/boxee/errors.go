@@ -0,0 +1,105 @@
+package boxee
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+)
+
+// error classes of APIError, use errors.Is to test for them
+var (
+	ErrBadRequest   = errors.New("bad request")
+	ErrUnauthorized = errors.New("unauthorized")
+	ErrForbidden    = errors.New("forbidden")
+	ErrNotFound     = errors.New("not found")
+	ErrConflict     = errors.New("conflict")
+	ErrServer       = errors.New("server error")
+	ErrClient       = errors.New("request failed")
+)
+
+var (
+	// ErrUnexpectedResponse is returned when a 2xx response does not carry the
+	// documented json payload
+	ErrUnexpectedResponse = errors.New("unexpected response from server")
+	ErrInvalidCredentials = fmt.Errorf("%w: invalid email or password", ErrUnauthorized)
+	ErrAccountLocked      = fmt.Errorf("%w: account locked after too many failed logins", ErrForbidden)
+	// ErrEmptySessionToken is returned when a login succeeded without a token
+	ErrEmptySessionToken = errors.New("the server accepted the login but sent no session token")
+	ErrNoSessionToken    = errors.New("empty token in " + SessionHeader + " header")
+	ErrNoClientKey       = errors.New("empty key in " + ClientKeyHeader + " header")
+	ErrDeviceQuery       = errors.New("a device id or name is required")
+)
+
+// APIError is returned for every non 2xx response from the box-ee api. It
+// unwraps to one of the Err* classes above so callers can use errors.Is
+type APIError struct {
+	StatusCode int
+	Msg        string
+	class      error
+}
+
+// NewAPIError returns the APIError of a response with statusCode and msg
+func NewAPIError(statusCode int, msg string) *APIError {
+	var class error
+	switch {
+	case statusCode == http.StatusBadRequest:
+		class = ErrBadRequest
+	case statusCode == http.StatusUnauthorized:
+		class = ErrUnauthorized
+	case statusCode == http.StatusForbidden:
+		class = ErrForbidden
+	case statusCode == http.StatusNotFound:
+		class = ErrNotFound
+	case statusCode == http.StatusConflict:
+		class = ErrConflict
+	case statusCode >= 500:
+		class = ErrServer
+	default:
+		class = ErrClient
+	}
+	return &APIError{StatusCode: statusCode, Msg: msg, class: class}
+}
+
+// ParseAPIError builds an APIError from a status code and the raw response
+// body. The msg of a json body is used, other bodies are kept as they are
+func ParseAPIError(statusCode int, body []byte) *APIError {
+	var stdResp StandardResponse
+	json.Unmarshal(body, &stdResp)
+	msg := stdResp.Msg
+	if msg == "" && len(body) > 0 && stdResp.StatusCode == 0 {
+		msg = string(body)
+	}
+	return NewAPIError(statusCode, msg)
+}
+
+func (e *APIError) Error() string {
+	if e.Msg == "" {
+		return fmt.Sprintf("%v (status %d)", e.class, e.StatusCode)
+	}
+	return fmt.Sprintf("%v: %v (status %d)", e.class, e.Msg, e.StatusCode)
+}
+
+func (e *APIError) Unwrap() error {
+	return e.class
+}
+
+// CheckResponse returns an APIError when statusCode is not a 2xx
+func CheckResponse(statusCode int, body []byte) error {
+	if statusCode >= 200 && statusCode < 300 {
+		return nil
+	}
+	return ParseAPIError(statusCode, body)
+}
+
+func unexpectedResponse(status string) error {
+	return fmt.Errorf("%w: %v", ErrUnexpectedResponse, status)
+}
+
+// withServerMsg adds the msg of an error response to err
+func withServerMsg(err error, statusCode int, body []byte) error {
+	if msg := ParseAPIError(statusCode, body).Msg; msg != "" {
+		return fmt.Errorf("%w (server: %v)", err, msg)
+	}
+	return err
+}
@@ -0,0 +1,120 @@
+package boxee
+
+import (
+	"context"
+)
+
+// MaxPageSize is the largest limit the box-ee api accepts on list endpoints
+const MaxPageSize int = 100
+
+// ListOptions select a page of a list endpoint. Zero values leave the choice
+// to the server, which starts at page 1 with 20 items per page
+type ListOptions struct {
+	Page  int
+	Limit int
+}
+
+func (o ListOptions) params() (page, limit *int) {
+	if o.Page > 0 {
+		page = &o.Page
+	}
+	if o.Limit > 0 {
+		limit = &o.Limit
+	}
+	return page, limit
+}
+
+// IterOptions configure an Iterator. Limit is the page size and defaults to
+// MaxPageSize. MaxItems stops the iteration after that many items, 0 means no cap
+type IterOptions struct {
+	Limit    int
+	MaxItems int
+}
+
+// PageFetcher fetches a single page of a list endpoint and returns the items on
+// that page together with the total number of items the server reports
+type PageFetcher[T any] func(ctx context.Context, page, limit int) ([]T, int, error)
+
+// Iterator walks a list endpoint page by page until the reported count is
+// exhausted, the server returns an empty page or MaxItems have been seen
+//
+//	it := api.Devices.Iter(boxee.IterOptions{})
+//	for it.Next(ctx) {
+//		for _, d := range it.Page() {
+//			...
+//		}
+//	}
+//	if err := it.Err(); err != nil {
+//		...
+//	}
+type Iterator[T any] struct {
+	fetch    PageFetcher[T]
+	limit    int
+	maxItems int
+
+	page  int
+	seen  int
+	items []T
+	done  bool
+	err   error
+}
+
+// NewIterator returns an iterator over the pages fetch returns
+func NewIterator[T any](fetch PageFetcher[T], opts IterOptions) *Iterator[T] {
+	limit := opts.Limit
+	if limit <= 0 || limit > MaxPageSize {
+		limit = MaxPageSize
+	}
+	return &Iterator[T]{
+		fetch:    fetch,
+		limit:    limit,
+		maxItems: opts.MaxItems,
+	}
+}
+
+// Next fetches the next page. It returns false once iteration is finished or
+// an error occurred, check Err afterwards
+func (it *Iterator[T]) Next(ctx context.Context) bool {
+	if it.done || it.err != nil {
+		return false
+	}
+	it.page++
+	items, count, err := it.fetch(ctx, it.page, it.limit)
+	if err != nil {
+		it.err = err
+		return false
+	}
+	if len(items) == 0 {
+		it.done = true
+		return false
+	}
+	if it.maxItems > 0 && it.seen+len(items) >= it.maxItems {
+		items = items[:it.maxItems-it.seen]
+		it.done = true
+	}
+	it.seen += len(items)
+	if it.seen >= count {
+		it.done = true
+	}
+	it.items = items
+	return true
+}
+
+// Page returns the items fetched by the last call to Next
+func (it *Iterator[T]) Page() []T {
+	return it.items
+}
+
+// Err returns the error that stopped the iteration, if any
+func (it *Iterator[T]) Err() error {
+	return it.err
+}
+
+// All drains the iterator and returns every item
+func (it *Iterator[T]) All(ctx context.Context) ([]T, error) {
+	var all []T
+	for it.Next(ctx) {
+		all = append(all, it.Page()...)
+	}
+	return all, it.Err()
+}
@@ -0,0 +1,42 @@
+package boxee
+
+import (
+	"context"
+)
+
+// PinsService validates the pin keys of trackings. It is authenticated with
+// a device client key, see WithClientKey
+type PinsService struct {
+	client *ClientWithResponses
+}
+
+// PinValidation is the verdict of the server on a pin key
+type PinValidation struct {
+	PinKey string `json:"pin_key"`
+	Valid  bool   `json:"valid"`
+	Msg    string `json:"msg,omitempty"`
+}
+
+// Validate checks a pin key. Unknown and malformed pin keys are reported as
+// invalid, an error means the pin key could not be checked
+func (s *PinsService) Validate(ctx context.Context, pinKey string) (*PinValidation, error) {
+	resp, err := s.client.ClientValidateWithResponse(ctx, &ClientValidateParams{Pinkey: pinKey})
+	if err != nil {
+		return nil, err
+	}
+	result := &PinValidation{PinKey: pinKey}
+	switch {
+	case resp.JSON200 != nil:
+		result.Valid = resp.JSON200.Valid
+		result.Msg = resp.JSON200.Msg
+	case resp.JSON400 != nil:
+		//a malformed pin key is reported as invalid rather than as an error
+		result.Msg = resp.JSON400.Msg
+	default:
+		if err := CheckResponse(resp.StatusCode(), resp.Body); err != nil {
+			return nil, err
+		}
+		return nil, unexpectedResponse(resp.Status())
+	}
+	return result, nil
+}
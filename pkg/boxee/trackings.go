@@ -0,0 +1,104 @@
+package boxee
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+)
+
+// TrackingsService manages the tracking numbers of the logged in account
+type TrackingsService struct {
+	client *ClientWithResponses
+}
+
+// List returns a page of trackings, of a single device when deviceID is set
+func (s *TrackingsService) List(ctx context.Context, deviceID string, opts ListOptions) (*ListTrackings, error) {
+	page, limit := opts.params()
+	params := ListTrackingsParams{Page: page, Limit: limit}
+	if deviceID != "" {
+		params.DeviceId = &deviceID
+	}
+	resp, err := s.client.ListTrackingsWithResponse(ctx, &params)
+	if err != nil {
+		return nil, err
+	}
+	if err := CheckResponse(resp.StatusCode(), resp.Body); err != nil {
+		return nil, err
+	}
+	if resp.JSON200 == nil {
+		return nil, unexpectedResponse(resp.Status())
+	}
+	return resp.JSON200, nil
+}
+
+// Iter returns an iterator over every tracking, of a single device when
+// deviceID is set
+func (s *TrackingsService) Iter(deviceID string, opts IterOptions) *Iterator[TrackingObjectModel] {
+	return NewIterator(func(ctx context.Context, page, limit int) ([]TrackingObjectModel, int, error) {
+		list, err := s.List(ctx, deviceID, ListOptions{Page: page, Limit: limit})
+		if err != nil {
+			return nil, 0, err
+		}
+		return list.Trackings, list.Count, nil
+	}, opts)
+}
+
+// Get returns a tracking with its pin key and creation time. A tracking
+// number the device does not have is an APIError with ErrNotFound
+func (s *TrackingsService) Get(ctx context.Context, trackingNumber, deviceID string) (*TrackingGetResponse, error) {
+	resp, err := s.client.GetTrackingWithResponse(ctx, &GetTrackingParams{
+		TrackingNumber: trackingNumber,
+		DeviceId:       deviceID,
+	})
+	if err != nil {
+		return nil, err
+	}
+	//the api answers an unknown tracking number with a 400 or an empty record
+	notFound := NewAPIError(http.StatusNotFound, fmt.Sprintf("tracking number %v not found on device %v", trackingNumber, deviceID))
+	if err := CheckResponse(resp.StatusCode(), resp.Body); err != nil {
+		if errors.Is(err, ErrBadRequest) || errors.Is(err, ErrNotFound) {
+			return nil, notFound
+		}
+		return nil, err
+	}
+	if resp.JSON200 == nil || resp.JSON200.Id == "" {
+		return nil, notFound
+	}
+	return resp.JSON200, nil
+}
+
+// Add adds a tracking number to the device with deviceID. Without a device id
+// the server picks the device
+func (s *TrackingsService) Add(ctx context.Context, trackingNumber, deviceID string) (*StandardResponse, error) {
+	payload := TrackingRequestItem{TrackingNumber: trackingNumber}
+	if deviceID != "" {
+		payload.DeviceId = &deviceID
+	}
+	resp, err := s.client.AddTrackingWithResponse(ctx, payload)
+	if err != nil {
+		return nil, err
+	}
+	if err := CheckResponse(resp.StatusCode(), resp.Body); err != nil {
+		return nil, err
+	}
+	if resp.JSON201 == nil {
+		return nil, unexpectedResponse(resp.Status())
+	}
+	return resp.JSON201, nil
+}
+
+// Delete removes the tracking with id
+func (s *TrackingsService) Delete(ctx context.Context, id string) (*StandardResponse, error) {
+	resp, err := s.client.DeleteTrackingWithResponse(ctx, &DeleteTrackingParams{TrackingId: id})
+	if err != nil {
+		return nil, err
+	}
+	if err := CheckResponse(resp.StatusCode(), resp.Body); err != nil {
+		return nil, err
+	}
+	if resp.JSON200 == nil {
+		return nil, unexpectedResponse(resp.Status())
+	}
+	return resp.JSON200, nil
+}
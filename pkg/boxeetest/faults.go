@@ -0,0 +1,101 @@
+package boxeetest
+
+import (
+	"errors"
+	"math"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// Faults are applied to every request before it is routed
+type Faults struct {
+	// Latency delays every response, Jitter adds up to that much at random
+	Latency time.Duration
+	Jitter  time.Duration
+	// ErrorRate is the fraction of requests answered with ErrorStatus, 500
+	// when unset
+	ErrorRate   float64
+	ErrorStatus int
+	// ThrottleRate is the fraction of requests answered 429 with a
+	// Retry-After of RetryAfter, rounded up to whole seconds. The header is
+	// left out when RetryAfter is 0
+	ThrottleRate float64
+	RetryAfter   time.Duration
+}
+
+// Validate checks the rates are fractions and the error status is a 5xx
+func (f Faults) Validate() error {
+	switch {
+	case f.Latency < 0 || f.Jitter < 0 || f.RetryAfter < 0:
+		return errors.New("latency, jitter and retry after cannot be negative")
+	case f.ErrorRate < 0 || f.ErrorRate > 1:
+		return errors.New("error rate must be between 0 and 1")
+	case f.ThrottleRate < 0 || f.ThrottleRate > 1:
+		return errors.New("throttle rate must be between 0 and 1")
+	case f.ErrorStatus != 0 && (f.ErrorStatus < 500 || f.ErrorStatus > 599):
+		return errors.New("error status must be a 5xx status")
+	}
+	return nil
+}
+
+// SetFaults replaces the faults applied to the following requests
+func (s *Server) SetFaults(f Faults) error {
+	if err := f.Validate(); err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.faults = f
+	return nil
+}
+
+// FailNext answers the next n requests with status whatever the faults are.
+// A 429 carries the Retry-After of the faults
+func (s *Server) FailNext(status, n int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for i := 0; i < n; i++ {
+		s.failing = append(s.failing, status)
+	}
+}
+
+// pickFault returns the delay and the failure status for the next request. A
+// status of 0 lets the request through
+func (s *Server) pickFault() (time.Duration, int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	f := s.faults
+	delay := f.Latency
+	if f.Jitter > 0 {
+		delay += time.Duration(s.rnd.Int63n(int64(f.Jitter)))
+	}
+	if len(s.failing) > 0 {
+		status := s.failing[0]
+		s.failing = s.failing[1:]
+		return delay, status
+	}
+	if f.ThrottleRate > 0 && s.rnd.Float64() < f.ThrottleRate {
+		return delay, http.StatusTooManyRequests
+	}
+	if f.ErrorRate > 0 && s.rnd.Float64() < f.ErrorRate {
+		if f.ErrorStatus != 0 {
+			return delay, f.ErrorStatus
+		}
+		return delay, http.StatusInternalServerError
+	}
+	return delay, 0
+}
+
+// writeFault answers with an injected failure
+func (s *Server) writeFault(w http.ResponseWriter, status int) {
+	if status == http.StatusTooManyRequests {
+		s.mu.Lock()
+		retryAfter := s.faults.RetryAfter
+		s.mu.Unlock()
+		if retryAfter > 0 {
+			w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(retryAfter.Seconds()))))
+		}
+	}
+	writeMsg(w, status, "injected fault: "+http.StatusText(status))
+}
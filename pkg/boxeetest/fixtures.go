@@ -0,0 +1,153 @@
+package boxeetest
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Fixtures is the initial state of a server. Ids, keys and pin keys left empty
+// are generated
+type Fixtures struct {
+	Users   []UserFixture   `yaml:"users" json:"users"`
+	Devices []DeviceFixture `yaml:"devices" json:"devices"`
+}
+
+// UserFixture is an account. With SessionToken set the account is logged in
+// without calling login
+type UserFixture struct {
+	Email        string `yaml:"email" json:"email"`
+	Password     string `yaml:"password" json:"password"`
+	SessionToken string `yaml:"session_token,omitempty" json:"session_token,omitempty"`
+}
+
+// DeviceFixture is a device and its trackings. Owner defaults to the first
+// user of the fixtures, a device without any owner is shared by all accounts
+type DeviceFixture struct {
+	ID        string            `yaml:"id,omitempty" json:"id,omitempty"`
+	Name      string            `yaml:"name" json:"name"`
+	Type      string            `yaml:"type" json:"type"`
+	Prefix    string            `yaml:"prefix,omitempty" json:"prefix,omitempty"`
+	Health    int               `yaml:"health" json:"health"`
+	Owner     string            `yaml:"owner,omitempty" json:"owner,omitempty"`
+	ClientKey string            `yaml:"client_key,omitempty" json:"client_key,omitempty"`
+	Trackings []TrackingFixture `yaml:"trackings,omitempty" json:"trackings,omitempty"`
+}
+
+// TrackingFixture is a tracking number registered on a device
+type TrackingFixture struct {
+	ID             string    `yaml:"id,omitempty" json:"id,omitempty"`
+	TrackingNumber string    `yaml:"tracking_number" json:"tracking_number"`
+	PinKey         string    `yaml:"pin_key,omitempty" json:"pin_key,omitempty"`
+	Created        time.Time `yaml:"created,omitempty" json:"created,omitempty"`
+}
+
+// DefaultFixtures is a logged out account with a single healthy device and
+// client key, enough to try every command
+func DefaultFixtures() Fixtures {
+	return Fixtures{
+		Users: []UserFixture{{Email: "dev@box-ee.local", Password: "Boxee-dev-1"}},
+		Devices: []DeviceFixture{{
+			ID:        "dev-0001",
+			Name:      "front-porch",
+			Type:      "main",
+			Health:    1,
+			ClientKey: "ck_dev",
+			Trackings: []TrackingFixture{{ID: "trk-0001", TrackingNumber: "1Z999AA10123456784", PinKey: "123456"}},
+		}},
+	}
+}
+
+// LoadFixtures reads fixtures from a yaml or json file
+func LoadFixtures(path string) (Fixtures, error) {
+	var f Fixtures
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return f, err
+	}
+	if err := yaml.Unmarshal(data, &f); err != nil {
+		return f, fmt.Errorf("parsing fixtures %v: %w", path, err)
+	}
+	return f, nil
+}
+
+// seed adds fixtures to the state. The caller holds s.mu
+func (s *Server) seed(f Fixtures) error {
+	for _, u := range f.Users {
+		if u.Email == "" {
+			return errors.New("fixture user without email")
+		}
+		s.users[u.Email] = &user{email: u.Email, password: u.Password}
+		if u.SessionToken != "" {
+			s.sessions[u.SessionToken] = u.Email
+		}
+	}
+	defaultOwner := ""
+	if len(f.Users) > 0 {
+		defaultOwner = f.Users[0].Email
+	}
+	for _, df := range f.Devices {
+		d := &device{
+			id:     df.ID,
+			name:   df.Name,
+			typ:    df.Type,
+			prefix: df.Prefix,
+			health: df.Health,
+			owner:  df.Owner,
+		}
+		if d.id == "" {
+			d.id = s.nextID("dev")
+		} else if s.idTaken(d.id) {
+			return fmt.Errorf("duplicate fixture device id %v", d.id)
+		}
+		if d.owner == "" {
+			d.owner = defaultOwner
+		}
+		s.devices = append(s.devices, d)
+		if df.ClientKey != "" {
+			s.clientKeys[df.ClientKey] = clientKey{owner: d.owner, deviceID: d.id}
+		}
+		for _, tf := range df.Trackings {
+			t := &tracking{
+				id:       tf.ID,
+				number:   tf.TrackingNumber,
+				pinKey:   tf.PinKey,
+				deviceID: d.id,
+				created:  tf.Created,
+			}
+			if t.id == "" {
+				t.id = s.nextID("trk")
+			} else if s.idTaken(t.id) {
+				return fmt.Errorf("duplicate fixture tracking id %v", t.id)
+			}
+			if t.pinKey == "" {
+				t.pinKey = s.newPinKey()
+			} else if s.trackingByPin(t.pinKey) != nil {
+				return fmt.Errorf("duplicate fixture pin key %v", t.pinKey)
+			}
+			if t.created.IsZero() {
+				t.created = s.now()
+			}
+			s.trackings = append(s.trackings, t)
+		}
+	}
+	return nil
+}
+
+// idTaken reports whether a device or tracking already uses id
+func (s *Server) idTaken(id string) bool {
+	for _, d := range s.devices {
+		if d.id == id {
+			return true
+		}
+	}
+	for _, t := range s.trackings {
+		if t.id == id {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,551 @@
+package boxeetest
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// maxLimit is the largest page size the real api accepts
+const maxLimit = 100
+
+type standardResponse struct {
+	Msg        string `json:"msg"`
+	StatusCode int    `json:"status_code"`
+}
+
+type deviceObject struct {
+	Health    int              `json:"health"`
+	ID        string           `json:"id"`
+	Name      string           `json:"name"`
+	Prefix    *string          `json:"prefix,omitempty"`
+	Trackings []trackingObject `json:"trackings"`
+	Type      string           `json:"type"`
+}
+
+type trackingObject struct {
+	DeviceID       string `json:"device_id"`
+	ID             string `json:"id"`
+	PinKey         string `json:"pin_key"`
+	TrackingNumber string `json:"tracking_number"`
+}
+
+// route is a handler for a method and path. Session routes get the email of
+// the logged in account
+type route struct {
+	session bool
+	handle  func(w http.ResponseWriter, r *http.Request, email string)
+}
+
+// statusRecorder keeps the status written for the request log
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+}
+
+func (r *statusRecorder) WriteHeader(status int) {
+	r.status = status
+	r.ResponseWriter.WriteHeader(status)
+}
+
+func (s *Server) routes() map[string]route {
+	return map[string]route{
+		"GET /api/v1/client/validate":        {handle: s.clientValidate},
+		"GET /api/v1/device":                 {session: true, handle: s.findDevice},
+		"POST /api/v1/device":                {session: true, handle: s.addDevice},
+		"PATCH /api/v1/device":               {session: true, handle: s.updateDevice},
+		"DELETE /api/v1/device":              {session: true, handle: s.deleteDevice},
+		"POST /api/v1/device/generate-key":   {session: true, handle: s.generateKey},
+		"GET /api/v1/device/list":            {session: true, handle: s.listDevices},
+		"POST /api/v1/self-service/login":    {handle: s.login},
+		"POST /api/v1/self-service/recover":  {handle: s.recover},
+		"POST /api/v1/self-service/register": {handle: s.register},
+		"GET /api/v1/tracking":               {session: true, handle: s.getTracking},
+		"POST /api/v1/tracking":              {session: true, handle: s.addTracking},
+		"DELETE /api/v1/tracking":            {session: true, handle: s.deleteTracking},
+		"GET /api/v1/tracking/list":          {session: true, handle: s.listTrackings},
+	}
+}
+
+// ServeHTTP applies the faults and routes the request
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	rec := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+	defer func() {
+		s.mu.Lock()
+		s.requests = append(s.requests, Request{Method: r.Method, Path: r.URL.Path, Status: rec.status})
+		s.mu.Unlock()
+	}()
+
+	delay, status := s.pickFault()
+	if delay > 0 {
+		timer := time.NewTimer(delay)
+		defer timer.Stop()
+		select {
+		case <-timer.C:
+		case <-r.Context().Done():
+			rec.status = 0
+			return
+		}
+	}
+	if status != 0 {
+		s.writeFault(rec, status)
+		return
+	}
+
+	rt, ok := s.routes()[r.Method+" "+strings.TrimSuffix(r.URL.Path, "/")]
+	if !ok {
+		writeMsg(rec, http.StatusNotFound, "no route for "+r.Method+" "+r.URL.Path)
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var email string
+	if rt.session {
+		if email, ok = s.sessionUser(r); !ok {
+			writeMsg(rec, http.StatusUnauthorized, "invalid or expired session")
+			return
+		}
+	}
+	rt.handle(rec, r, email)
+}
+
+func (s *Server) clientValidate(w http.ResponseWriter, r *http.Request, _ string) {
+	key, ok := s.clientKeys[r.Header.Get(ClientKeyHeader)]
+	if !ok {
+		writeMsg(w, http.StatusUnauthorized, "invalid client key")
+		return
+	}
+	pin := r.URL.Query().Get("pinkey")
+	if !isPinKey(pin) {
+		writeMsg(w, http.StatusBadRequest, "pinkey must be 6 digits")
+		return
+	}
+	resp := struct {
+		standardResponse
+		Valid bool `json:"valid"`
+	}{standardResponse: standardResponse{Msg: "pin key not found", StatusCode: http.StatusOK}}
+	if t := s.trackingByPin(pin); t != nil {
+		if d := s.deviceByID(key.owner, t.deviceID); d != nil && (key.deviceID == "" || key.deviceID == d.id) {
+			resp.Msg, resp.Valid = "pin key is valid", true
+		}
+	}
+	writeJSON(w, http.StatusOK, resp)
+}
+
+func (s *Server) findDevice(w http.ResponseWriter, r *http.Request, email string) {
+	q := r.URL.Query()
+	id, name := q.Get("device_id"), q.Get("device_name")
+	if id == "" && name == "" {
+		writeMsg(w, http.StatusBadRequest, "device_id or device_name is required")
+		return
+	}
+	type deviceGet struct {
+		Health     string `json:"health"`
+		Msg        string `json:"msg"`
+		Name       string `json:"name"`
+		StatusCode int    `json:"status_code"`
+		Type       string `json:"type"`
+	}
+	found := []deviceGet{}
+	for _, d := range s.ownedDevices(email) {
+		if (id == "" || d.id == id) && (name == "" || d.name == name) {
+			found = append(found, deviceGet{
+				Health:     strconv.Itoa(d.health),
+				Msg:        "device found",
+				Name:       d.name,
+				StatusCode: http.StatusOK,
+				Type:       d.typ,
+			})
+		}
+	}
+	writeJSON(w, http.StatusOK, found)
+}
+
+type deviceCreated struct {
+	DeviceID   string `json:"device_id"`
+	DeviceName string `json:"device_name"`
+	DeviceType string `json:"device_type"`
+	Msg        string `json:"msg"`
+	StatusCode int    `json:"status_code"`
+}
+
+func (s *Server) addDevice(w http.ResponseWriter, r *http.Request, email string) {
+	var req struct {
+		DeviceName string `json:"device_name"`
+		DeviceType string `json:"device_type"`
+	}
+	if !readJSON(w, r, &req) {
+		return
+	}
+	if req.DeviceName == "" || req.DeviceType == "" {
+		writeMsg(w, http.StatusBadRequest, "device_name and device_type are required")
+		return
+	}
+	d := &device{id: s.nextID("dev"), name: req.DeviceName, typ: req.DeviceType, health: 1, owner: email}
+	s.devices = append(s.devices, d)
+	writeJSON(w, http.StatusCreated, deviceCreated{
+		DeviceID:   d.id,
+		DeviceName: d.name,
+		DeviceType: d.typ,
+		Msg:        "device created",
+		StatusCode: http.StatusCreated,
+	})
+}
+
+func (s *Server) updateDevice(w http.ResponseWriter, r *http.Request, email string) {
+	var req struct {
+		DeviceID string `json:"device_id"`
+		ToName   string `json:"to_name"`
+	}
+	if !readJSON(w, r, &req) {
+		return
+	}
+	if req.DeviceID == "" || req.ToName == "" {
+		writeMsg(w, http.StatusBadRequest, "device_id and to_name are required")
+		return
+	}
+	d := s.deviceByID(email, req.DeviceID)
+	if d == nil {
+		writeMsg(w, http.StatusNotFound, "device not found")
+		return
+	}
+	d.name = req.ToName
+	writeMsg(w, http.StatusOK, "device updated")
+}
+
+func (s *Server) deleteDevice(w http.ResponseWriter, r *http.Request, email string) {
+	id := r.URL.Query().Get("device_id")
+	if id == "" {
+		writeMsg(w, http.StatusBadRequest, "device_id is required")
+		return
+	}
+	d := s.deviceByID(email, id)
+	if d == nil {
+		writeMsg(w, http.StatusNotFound, "device not found")
+		return
+	}
+	for i, other := range s.devices {
+		if other == d {
+			s.devices = append(s.devices[:i], s.devices[i+1:]...)
+			break
+		}
+	}
+	trackings := s.trackings[:0]
+	for _, t := range s.trackings {
+		if t.deviceID != d.id {
+			trackings = append(trackings, t)
+		}
+	}
+	s.trackings = trackings
+	for k, ck := range s.clientKeys {
+		if ck.deviceID == d.id {
+			delete(s.clientKeys, k)
+		}
+	}
+	writeJSON(w, http.StatusOK, deviceCreated{
+		DeviceID:   d.id,
+		DeviceName: d.name,
+		DeviceType: d.typ,
+		Msg:        "device deleted",
+		StatusCode: http.StatusOK,
+	})
+}
+
+func (s *Server) generateKey(w http.ResponseWriter, r *http.Request, email string) {
+	var req struct {
+		DeviceID *string `json:"device_id"`
+	}
+	if !readJSON(w, r, &req) {
+		return
+	}
+	key := clientKey{owner: email}
+	if req.DeviceID != nil && *req.DeviceID != "" {
+		if s.deviceByID(email, *req.DeviceID) == nil {
+			writeMsg(w, http.StatusNotFound, "device not found")
+			return
+		}
+		key.deviceID = *req.DeviceID
+	}
+	value := "ck_" + s.randomHex(16)
+	s.clientKeys[value] = key
+	writeJSON(w, http.StatusCreated, struct {
+		ClientKey string `json:"client_key"`
+		standardResponse
+	}{value, standardResponse{Msg: "client key generated", StatusCode: http.StatusCreated}})
+}
+
+func (s *Server) listDevices(w http.ResponseWriter, r *http.Request, email string) {
+	page, limit, ok := pagination(w, r)
+	if !ok {
+		return
+	}
+	devices := s.ownedDevices(email)
+	resp := struct {
+		Count   int            `json:"count"`
+		Devices []deviceObject `json:"devices"`
+		standardResponse
+	}{Count: len(devices), Devices: []deviceObject{}, standardResponse: standardResponse{Msg: "devices listed", StatusCode: http.StatusOK}}
+	for _, d := range paginate(devices, page, limit) {
+		obj := deviceObject{Health: d.health, ID: d.id, Name: d.name, Type: d.typ, Trackings: []trackingObject{}}
+		if d.prefix != "" {
+			prefix := d.prefix
+			obj.Prefix = &prefix
+		}
+		for _, t := range s.deviceTrackings(d.id) {
+			obj.Trackings = append(obj.Trackings, t.object())
+		}
+		resp.Devices = append(resp.Devices, obj)
+	}
+	writeJSON(w, http.StatusOK, resp)
+}
+
+type credentials struct {
+	Email    string `json:"email"`
+	Password string `json:"password"`
+}
+
+func (s *Server) login(w http.ResponseWriter, r *http.Request, _ string) {
+	var req credentials
+	if !readJSON(w, r, &req) {
+		return
+	}
+	u, ok := s.users[req.Email]
+	if !ok || u.password != req.Password || req.Password == "" {
+		writeMsg(w, http.StatusBadRequest, "invalid email or password")
+		return
+	}
+	writeJSON(w, http.StatusOK, struct {
+		Msg          string `json:"msg"`
+		SessionToken string `json:"session_token"`
+		StatusCode   int    `json:"status_code"`
+	}{"login successful", s.newSession(u.email), http.StatusOK})
+}
+
+func (s *Server) register(w http.ResponseWriter, r *http.Request, _ string) {
+	var req credentials
+	if !readJSON(w, r, &req) {
+		return
+	}
+	if !strings.Contains(req.Email, "@") || req.Password == "" {
+		writeMsg(w, http.StatusBadRequest, "a valid email and a password are required")
+		return
+	}
+	if _, ok := s.users[req.Email]; ok {
+		writeMsg(w, http.StatusBadRequest, "email already registered")
+		return
+	}
+	s.users[req.Email] = &user{email: req.Email, password: req.Password}
+	token := s.newSession(req.Email)
+	writeJSON(w, http.StatusOK, struct {
+		Msg          string  `json:"msg"`
+		SessionToken *string `json:"session_token,omitempty"`
+		StatusCode   int     `json:"status_code"`
+	}{"account registered", &token, http.StatusOK})
+}
+
+func (s *Server) recover(w http.ResponseWriter, r *http.Request, _ string) {
+	var req struct {
+		Email string `json:"email"`
+	}
+	if !readJSON(w, r, &req) {
+		return
+	}
+	if !strings.Contains(req.Email, "@") {
+		writeMsg(w, http.StatusBadRequest, "a valid email is required")
+		return
+	}
+	//unknown emails get the same answer so accounts cannot be probed
+	if _, ok := s.users[req.Email]; ok {
+		s.recoveries = append(s.recoveries, req.Email)
+	}
+	writeMsg(w, http.StatusOK, "if the account exists a recovery email was sent")
+}
+
+func (s *Server) getTracking(w http.ResponseWriter, r *http.Request, email string) {
+	q := r.URL.Query()
+	number, deviceID := q.Get("tracking_number"), q.Get("device_id")
+	if number == "" || deviceID == "" {
+		writeMsg(w, http.StatusBadRequest, "tracking_number and device_id are required")
+		return
+	}
+	d := s.deviceByID(email, deviceID)
+	if d == nil {
+		writeMsg(w, http.StatusNotFound, "device not found")
+		return
+	}
+	for _, t := range s.deviceTrackings(d.id) {
+		if t.number == number {
+			writeJSON(w, http.StatusOK, struct {
+				Created  string `json:"created"`
+				DeviceID string `json:"device_id"`
+				ID       string `json:"id"`
+				Name     string `json:"name"`
+				PinKey   string `json:"pin_key"`
+			}{t.created.UTC().Format(time.RFC3339), d.id, t.id, t.number, t.pinKey})
+			return
+		}
+	}
+	writeMsg(w, http.StatusNotFound, "tracking not found")
+}
+
+func (s *Server) addTracking(w http.ResponseWriter, r *http.Request, email string) {
+	var req struct {
+		DeviceID       *string `json:"device_id"`
+		TrackingNumber string  `json:"tracking_number"`
+	}
+	if !readJSON(w, r, &req) {
+		return
+	}
+	if strings.TrimSpace(req.TrackingNumber) == "" {
+		writeMsg(w, http.StatusBadRequest, "tracking_number is required")
+		return
+	}
+	//without a device id the tracking goes to the first device of the account
+	var d *device
+	if req.DeviceID != nil && *req.DeviceID != "" {
+		if d = s.deviceByID(email, *req.DeviceID); d == nil {
+			writeMsg(w, http.StatusNotFound, "device not found")
+			return
+		}
+	} else if devices := s.ownedDevices(email); len(devices) > 0 {
+		d = devices[0]
+	} else {
+		writeMsg(w, http.StatusBadRequest, "no device to add the tracking to. Add a device first")
+		return
+	}
+	for _, t := range s.deviceTrackings(d.id) {
+		if t.number == req.TrackingNumber {
+			writeMsg(w, http.StatusConflict, "tracking number already added to device")
+			return
+		}
+	}
+	s.trackings = append(s.trackings, &tracking{
+		id:       s.nextID("trk"),
+		number:   req.TrackingNumber,
+		pinKey:   s.newPinKey(),
+		deviceID: d.id,
+		created:  s.now(),
+	})
+	writeMsg(w, http.StatusCreated, "tracking added")
+}
+
+func (s *Server) deleteTracking(w http.ResponseWriter, r *http.Request, email string) {
+	id := r.URL.Query().Get("tracking_id")
+	if id == "" {
+		writeMsg(w, http.StatusBadRequest, "tracking_id is required")
+		return
+	}
+	for i, t := range s.trackings {
+		if t.id == id && s.deviceByID(email, t.deviceID) != nil {
+			s.trackings = append(s.trackings[:i], s.trackings[i+1:]...)
+			writeMsg(w, http.StatusOK, "tracking deleted")
+			return
+		}
+	}
+	writeMsg(w, http.StatusNotFound, "tracking not found")
+}
+
+func (s *Server) listTrackings(w http.ResponseWriter, r *http.Request, email string) {
+	page, limit, ok := pagination(w, r)
+	if !ok {
+		return
+	}
+	deviceID := r.URL.Query().Get("device_id")
+	var trackings []*tracking
+	for _, t := range s.trackings {
+		if (deviceID == "" || t.deviceID == deviceID) && s.deviceByID(email, t.deviceID) != nil {
+			trackings = append(trackings, t)
+		}
+	}
+	resp := struct {
+		Count int `json:"count"`
+		standardResponse
+		Trackings []trackingObject `json:"trackings"`
+	}{Count: len(trackings), standardResponse: standardResponse{Msg: "trackings listed", StatusCode: http.StatusOK}, Trackings: []trackingObject{}}
+	for _, t := range paginate(trackings, page, limit) {
+		resp.Trackings = append(resp.Trackings, t.object())
+	}
+	writeJSON(w, http.StatusOK, resp)
+}
+
+func (t *tracking) object() trackingObject {
+	return trackingObject{DeviceID: t.deviceID, ID: t.id, PinKey: t.pinKey, TrackingNumber: t.number}
+}
+
+// pagination reads page and limit, defaulting to the first page of 20
+func pagination(w http.ResponseWriter, r *http.Request) (int, int, bool) {
+	page, limit := 1, 20
+	q := r.URL.Query()
+	for _, p := range []struct {
+		name  string
+		value *int
+	}{{"page", &page}, {"limit", &limit}} {
+		raw := q.Get(p.name)
+		if raw == "" {
+			continue
+		}
+		n, err := strconv.Atoi(raw)
+		if err != nil || n < 0 {
+			writeMsg(w, http.StatusBadRequest, p.name+" must be a positive number")
+			return 0, 0, false
+		}
+		*p.value = n
+	}
+	if limit > maxLimit {
+		writeMsg(w, http.StatusBadRequest, "limit is 100")
+		return 0, 0, false
+	}
+	if page < 1 {
+		page = 1
+	}
+	if limit == 0 {
+		limit = 20
+	}
+	return page, limit, true
+}
+
+// paginate returns the items on page
+func paginate[T any](items []T, page, limit int) []T {
+	start := (page - 1) * limit
+	if start >= len(items) {
+		return nil
+	}
+	end := start + limit
+	if end > len(items) {
+		end = len(items)
+	}
+	return items[start:end]
+}
+
+func isPinKey(pin string) bool {
+	if len(pin) != 6 {
+		return false
+	}
+	for _, r := range pin {
+		if r < '0' || r > '9' {
+			return false
+		}
+	}
+	return true
+}
+
+// readJSON decodes the request body into v and answers 400 when it is not json
+func readJSON(w http.ResponseWriter, r *http.Request, v interface{}) bool {
+	if err := json.NewDecoder(r.Body).Decode(v); err != nil {
+		writeMsg(w, http.StatusBadRequest, "invalid json body: "+err.Error())
+		return false
+	}
+	return true
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
+
+func writeMsg(w http.ResponseWriter, status int, msg string) {
+	writeJSON(w, status, standardResponse{Msg: msg, StatusCode: status})
+}
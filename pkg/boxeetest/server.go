@@ -0,0 +1,272 @@
+// Package boxeetest is an in-memory fake of the box-ee api. A Server is an
+// http.Handler implementing every route of the generated client, so it can be
+// wrapped in httptest.NewServer for tests or served by boxee dev server for
+// offline development and firmware testing:
+//
+//	srv := boxeetest.New(boxeetest.WithFixtures(boxeetest.DefaultFixtures()))
+//	ts := httptest.NewServer(srv)
+//	defer ts.Close()
+//
+// State lives in memory and is lost when the process exits. Latency, 5xx and
+// 429 responses can be injected with SetFaults and FailNext.
+package boxeetest
+
+import (
+	"crypto/rand"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	mathrand "math/rand"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// Header names used by the box-ee api
+const (
+	SessionHeader   = "X-Boxee-Auth"
+	ClientKeyHeader = "clientApiKey"
+)
+
+type user struct {
+	email    string
+	password string
+}
+
+type device struct {
+	id     string
+	name   string
+	typ    string
+	prefix string
+	health int
+	owner  string
+}
+
+type tracking struct {
+	id       string
+	number   string
+	pinKey   string
+	deviceID string
+	created  time.Time
+}
+
+// clientKey is what a key from generate-key unlocks. Keys generated without a
+// device id validate the pins of every device of the owner
+type clientKey struct {
+	owner    string
+	deviceID string
+}
+
+// Request is a request the server answered, as returned by Requests
+type Request struct {
+	Method string
+	Path   string
+	Status int
+}
+
+// Server is the fake box-ee api. The zero value is not usable, use New
+type Server struct {
+	mu         sync.Mutex
+	users      map[string]*user
+	sessions   map[string]string
+	devices    []*device
+	trackings  []*tracking
+	clientKeys map[string]clientKey
+	recoveries []string
+	requests   []Request
+	seq        int
+
+	faults  Faults
+	failing []int
+	rnd     *mathrand.Rand
+	now     func() time.Time
+}
+
+// Option configures a Server
+type Option func(*options)
+
+type options struct {
+	fixtures []Fixtures
+	faults   Faults
+	seed     *int64
+	now      func() time.Time
+}
+
+// WithFixtures seeds the server with fixtures
+func WithFixtures(f Fixtures) Option {
+	return func(o *options) {
+		o.fixtures = append(o.fixtures, f)
+	}
+}
+
+// WithFaults injects faults from the first request on
+func WithFaults(f Faults) Option {
+	return func(o *options) {
+		o.faults = f
+	}
+}
+
+// WithSeed makes generated tokens, keys, pin keys and fault decisions
+// reproducible
+func WithSeed(seed int64) Option {
+	return func(o *options) {
+		o.seed = &seed
+	}
+}
+
+// WithClock sets the clock used for tracking creation times
+func WithClock(now func() time.Time) Option {
+	return func(o *options) {
+		o.now = now
+	}
+}
+
+// New returns a server configured by opts. It panics when the fixtures are
+// invalid, use Seed to get the error instead
+func New(opts ...Option) *Server {
+	o := options{now: time.Now}
+	for _, opt := range opts {
+		opt(&o)
+	}
+	if o.seed == nil {
+		var b [8]byte
+		rand.Read(b[:])
+		seed := int64(binary.LittleEndian.Uint64(b[:]) >> 1)
+		o.seed = &seed
+	}
+	s := &Server{
+		users:      map[string]*user{},
+		sessions:   map[string]string{},
+		clientKeys: map[string]clientKey{},
+		faults:     o.faults,
+		rnd:        mathrand.New(mathrand.NewSource(*o.seed)),
+		now:        o.now,
+	}
+	for _, f := range o.fixtures {
+		if err := s.seed(f); err != nil {
+			panic(err)
+		}
+	}
+	return s
+}
+
+// Seed adds fixtures to the running server
+func (s *Server) Seed(f Fixtures) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.seed(f)
+}
+
+// Reset drops all state, faults and recorded requests
+func (s *Server) Reset() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.users = map[string]*user{}
+	s.sessions = map[string]string{}
+	s.clientKeys = map[string]clientKey{}
+	s.devices = nil
+	s.trackings = nil
+	s.recoveries = nil
+	s.requests = nil
+	s.faults = Faults{}
+	s.failing = nil
+}
+
+// Requests returns the requests answered so far, faults included
+func (s *Server) Requests() []Request {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]Request(nil), s.requests...)
+}
+
+// Recoveries returns the emails password recovery was requested for
+func (s *Server) Recoveries() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]string(nil), s.recoveries...)
+}
+
+// nextID returns an unused sequential id with prefix, so ids are stable
+// across runs
+func (s *Server) nextID(prefix string) string {
+	for {
+		s.seq++
+		if id := fmt.Sprintf("%v-%04d", prefix, s.seq); !s.idTaken(id) {
+			return id
+		}
+	}
+}
+
+// randomHex returns n random bytes as hex from the server's random source
+func (s *Server) randomHex(n int) string {
+	b := make([]byte, n)
+	s.rnd.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// newPinKey returns an unused six digit pin key
+func (s *Server) newPinKey() string {
+	for {
+		pin := fmt.Sprintf("%06d", s.rnd.Intn(1000000))
+		if s.trackingByPin(pin) == nil {
+			return pin
+		}
+	}
+}
+
+// newSession issues a session token for email
+func (s *Server) newSession(email string) string {
+	token := "sess_" + s.randomHex(16)
+	s.sessions[token] = email
+	return token
+}
+
+// sessionUser returns the account of the session token of r
+func (s *Server) sessionUser(r *http.Request) (string, bool) {
+	email, ok := s.sessions[r.Header.Get(SessionHeader)]
+	return email, ok
+}
+
+func (s *Server) deviceByID(owner, id string) *device {
+	for _, d := range s.devices {
+		if d.id == id && d.visibleTo(owner) {
+			return d
+		}
+	}
+	return nil
+}
+
+func (s *Server) ownedDevices(owner string) []*device {
+	var devices []*device
+	for _, d := range s.devices {
+		if d.visibleTo(owner) {
+			devices = append(devices, d)
+		}
+	}
+	return devices
+}
+
+func (s *Server) deviceTrackings(deviceID string) []*tracking {
+	var trackings []*tracking
+	for _, t := range s.trackings {
+		if t.deviceID == deviceID {
+			trackings = append(trackings, t)
+		}
+	}
+	return trackings
+}
+
+func (s *Server) trackingByPin(pin string) *tracking {
+	for _, t := range s.trackings {
+		if t.pinKey == pin {
+			return t
+		}
+	}
+	return nil
+}
+
+// visibleTo reports whether the account owner can see the device. Devices
+// seeded without an owner are shared by every account
+func (d *device) visibleTo(owner string) bool {
+	return d.owner == "" || d.owner == owner
+}
@@ -0,0 +1,385 @@
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"reflect"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"text/template"
+
+	"github.com/epuerta9/box-ee-cli/pkg/boxee"
+	"gopkg.in/yaml.v3"
+)
+
+const outputFormats string = "json|yaml|table|wide|csv|jsonpath=<template>|go-template=<template>"
+
+var ErrorUnknownOutput = errors.New("unknown output format. Supported formats are " + outputFormats)
+
+// printer renders a command result to w
+type printer interface {
+	Print(w io.Writer, v interface{}) error
+}
+
+// newPrinter returns the printer for an --output value
+func newPrinter(format string) (printer, error) {
+	name, arg := format, ""
+	if i := strings.Index(format, "="); i >= 0 {
+		name, arg = format[:i], format[i+1:]
+	}
+	switch name {
+	case "", "json":
+		return jsonPrinter{}, nil
+	case "yaml":
+		return yamlPrinter{}, nil
+	case "table":
+		return tablePrinter{}, nil
+	case "wide":
+		return tablePrinter{wide: true}, nil
+	case "csv":
+		return csvPrinter{}, nil
+	case "jsonpath":
+		if arg == "" {
+			return nil, errors.New("jsonpath output needs a template, for example -o jsonpath={.devices[*].id}")
+		}
+		return jsonPathPrinter{template: arg}, nil
+	case "go-template":
+		if arg == "" {
+			return nil, errors.New("go-template output needs a template, for example -o go-template={{.count}}")
+		}
+		tmpl, err := template.New("output").Parse(arg)
+		if err != nil {
+			return nil, fmt.Errorf("invalid go-template: %w", err)
+		}
+		return goTemplatePrinter{tmpl: tmpl}, nil
+	default:
+		return nil, ErrorUnknownOutput
+	}
+}
+
+type jsonPrinter struct{}
+
+func (jsonPrinter) Print(w io.Writer, v interface{}) error {
+	return json.NewEncoder(w).Encode(v)
+}
+
+type yamlPrinter struct{}
+
+func (yamlPrinter) Print(w io.Writer, v interface{}) error {
+	//round trip through json so keys match the api field names
+	generic, err := toGeneric(v)
+	if err != nil {
+		return err
+	}
+	enc := yaml.NewEncoder(w)
+	enc.SetIndent(2)
+	if err := enc.Encode(generic); err != nil {
+		return err
+	}
+	return enc.Close()
+}
+
+type tablePrinter struct {
+	wide bool
+}
+
+func (p tablePrinter) Print(w io.Writer, v interface{}) error {
+	headers, rows := tableRows(v, p.wide)
+	tw := tabwriter.NewWriter(w, 0, 4, 3, ' ', 0)
+	fmt.Fprintln(tw, strings.Join(headers, "\t"))
+	for _, r := range rows {
+		fmt.Fprintln(tw, strings.Join(r, "\t"))
+	}
+	return tw.Flush()
+}
+
+type csvPrinter struct{}
+
+func (csvPrinter) Print(w io.Writer, v interface{}) error {
+	headers, rows := tableRows(v, true)
+	cw := csv.NewWriter(w)
+	if err := cw.Write(headers); err != nil {
+		return err
+	}
+	return cw.WriteAll(rows)
+}
+
+type goTemplatePrinter struct {
+	tmpl *template.Template
+}
+
+func (p goTemplatePrinter) Print(w io.Writer, v interface{}) error {
+	generic, err := toGeneric(v)
+	if err != nil {
+		return err
+	}
+	return p.tmpl.Execute(w, generic)
+}
+
+type jsonPathPrinter struct {
+	template string
+}
+
+func (p jsonPathPrinter) Print(w io.Writer, v interface{}) error {
+	generic, err := toGeneric(v)
+	if err != nil {
+		return err
+	}
+	out, err := evalJSONPath(p.template, generic)
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintln(w, out)
+	return err
+}
+
+// toGeneric converts v into maps and slices keyed by the json field names
+func toGeneric(v interface{}) (interface{}, error) {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	var generic interface{}
+	err = json.Unmarshal(b, &generic)
+	return generic, err
+}
+
+// tableRows returns the header and rows used by the table and csv printers.
+// Lists and objects of the api models get curated columns, anything else is
+// rendered from its scalar json fields
+func tableRows(v interface{}, wide bool) ([]string, [][]string) {
+	switch t := v.(type) {
+	case *boxee.ListDevices:
+		return tableRows(t.Devices, wide)
+	case boxee.ListDevices:
+		return tableRows(t.Devices, wide)
+	case *boxee.ListTrackings:
+		return tableRows(t.Trackings, wide)
+	case boxee.ListTrackings:
+		return tableRows(t.Trackings, wide)
+	case boxee.DeviceObjectModel:
+		return tableRows([]boxee.DeviceObjectModel{t}, wide)
+	case *boxee.DeviceObjectModel:
+		return tableRows([]boxee.DeviceObjectModel{*t}, wide)
+	case boxee.TrackingObjectModel:
+		return tableRows([]boxee.TrackingObjectModel{t}, wide)
+	case *boxee.TrackingObjectModel:
+		return tableRows([]boxee.TrackingObjectModel{*t}, wide)
+	case []boxee.DeviceObjectModel:
+		headers := []string{"ID", "NAME", "TYPE", "HEALTH"}
+		if wide {
+			headers = append(headers, "PREFIX", "TRACKINGS")
+		}
+		var rows [][]string
+		for _, d := range t {
+			row := []string{d.Id, d.Name, d.Type, readableHealth(strconv.Itoa(d.Health))}
+			if wide {
+				prefix, trackings := "", 0
+				if d.Prefix != nil {
+					prefix = *d.Prefix
+				}
+				if d.Trackings != nil {
+					trackings = len(*d.Trackings)
+				}
+				row = append(row, prefix, strconv.Itoa(trackings))
+			}
+			rows = append(rows, row)
+		}
+		return headers, rows
+	case []boxee.TrackingObjectModel:
+		headers := []string{"ID", "TRACKING NUMBER", "DEVICE ID"}
+		if wide {
+			headers = append(headers, "PIN KEY")
+		}
+		var rows [][]string
+		for _, tr := range t {
+			row := []string{tr.Id, tr.TrackingNumber, tr.DeviceId}
+			if wide {
+				row = append(row, tr.PinKey)
+			}
+			rows = append(rows, row)
+		}
+		return headers, rows
+	default:
+		return reflectRows(v)
+	}
+}
+
+// reflectRows builds a table from the scalar fields of a struct or a slice of structs
+func reflectRows(v interface{}) ([]string, [][]string) {
+	rv := reflect.ValueOf(v)
+	for rv.Kind() == reflect.Ptr {
+		if rv.IsNil() {
+			return nil, nil
+		}
+		rv = rv.Elem()
+	}
+	var items []reflect.Value
+	switch rv.Kind() {
+	case reflect.Slice, reflect.Array:
+		for i := 0; i < rv.Len(); i++ {
+			items = append(items, reflect.Indirect(rv.Index(i)))
+		}
+	default:
+		items = []reflect.Value{rv}
+	}
+	if len(items) == 0 || items[0].Kind() != reflect.Struct {
+		return []string{"VALUE"}, [][]string{{fmt.Sprint(v)}}
+	}
+
+	var headers []string
+	var fields []int
+	st := items[0].Type()
+	for i := 0; i < st.NumField(); i++ {
+		f := st.Field(i)
+		if !f.IsExported() || !isScalar(f.Type) {
+			continue
+		}
+		name := strings.Split(f.Tag.Get("json"), ",")[0]
+		if name == "" {
+			name = f.Name
+		}
+		headers = append(headers, strings.ToUpper(strings.ReplaceAll(name, "_", " ")))
+		fields = append(fields, i)
+	}
+	var rows [][]string
+	for _, item := range items {
+		var row []string
+		for _, i := range fields {
+			fv := item.Field(i)
+			if fv.Kind() == reflect.Ptr {
+				if fv.IsNil() {
+					row = append(row, "")
+					continue
+				}
+				fv = fv.Elem()
+			}
+			row = append(row, fmt.Sprint(fv.Interface()))
+		}
+		rows = append(rows, row)
+	}
+	return headers, rows
+}
+
+func isScalar(t reflect.Type) bool {
+	if t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	switch t.Kind() {
+	case reflect.Struct, reflect.Slice, reflect.Array, reflect.Map, reflect.Interface:
+		return false
+	}
+	return true
+}
+
+// evalJSONPath evaluates a kubectl style jsonpath template such as
+// "{.devices[*].name}" against a generic value. Literal text outside of
+// braces is copied as is and multiple results are separated by spaces
+func evalJSONPath(tmpl string, data interface{}) (string, error) {
+	var out strings.Builder
+	for tmpl != "" {
+		start := strings.Index(tmpl, "{")
+		if start < 0 {
+			out.WriteString(tmpl)
+			break
+		}
+		end := strings.Index(tmpl[start:], "}")
+		if end < 0 {
+			return "", fmt.Errorf("unclosed brace in jsonpath %q", tmpl)
+		}
+		out.WriteString(tmpl[:start])
+		values, err := lookupPath(tmpl[start+1:start+end], data)
+		if err != nil {
+			return "", err
+		}
+		var parts []string
+		for _, val := range values {
+			parts = append(parts, scalarString(val))
+		}
+		out.WriteString(strings.Join(parts, " "))
+		tmpl = tmpl[start+end+1:]
+	}
+	return out.String(), nil
+}
+
+// lookupPath resolves a dotted path with optional [n] and [*] indexes. A key
+// missing from every value it is looked up in is an error, as in kubectl
+func lookupPath(path string, data interface{}) ([]interface{}, error) {
+	path = strings.TrimPrefix(strings.TrimSpace(path), "$")
+	current := []interface{}{data}
+	for _, segment := range strings.Split(path, ".") {
+		if segment == "" {
+			continue
+		}
+		key, index := segment, ""
+		if i := strings.Index(segment, "["); i >= 0 {
+			if !strings.HasSuffix(segment, "]") {
+				return nil, fmt.Errorf("invalid jsonpath segment %q", segment)
+			}
+			key, index = segment[:i], segment[i+1:len(segment)-1]
+		}
+		var next []interface{}
+		found := false
+		for _, c := range current {
+			if key != "" {
+				m, ok := c.(map[string]interface{})
+				if !ok {
+					continue
+				}
+				val, ok := m[key]
+				if !ok {
+					continue
+				}
+				found = true
+				c = val
+			}
+			if index == "" {
+				next = append(next, c)
+				continue
+			}
+			list, ok := c.([]interface{})
+			if !ok {
+				continue
+			}
+			if index == "*" {
+				next = append(next, list...)
+				continue
+			}
+			n, err := strconv.Atoi(index)
+			if err != nil {
+				return nil, fmt.Errorf("invalid jsonpath index %q", index)
+			}
+			if n < 0 {
+				n += len(list)
+			}
+			if n >= 0 && n < len(list) {
+				next = append(next, list[n])
+			}
+		}
+		//an empty list before the key, as in {.devices[*].id} without
+		//devices, is not a missing key
+		if key != "" && !found && len(current) > 0 {
+			return nil, fmt.Errorf("jsonpath key %q is not found", key)
+		}
+		current = next
+	}
+	return current, nil
+}
+
+func scalarString(v interface{}) string {
+	switch t := v.(type) {
+	case string:
+		return t
+	case nil:
+		return ""
+	case float64:
+		return strconv.FormatFloat(t, 'f', -1, 64)
+	default:
+		b, _ := json.Marshal(t)
+		return string(b)
+	}
+}
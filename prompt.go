@@ -0,0 +1,165 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"unicode"
+
+	"github.com/spf13/cobra"
+	"golang.org/x/term"
+)
+
+const strictSecretsEnvName string = "BOXEE_STRICT_SECRETS"
+
+var (
+	ErrorPasswordFlagRefused = errors.New("--password is refused while " + strictSecretsEnvName + " is set. Use the prompt or --password-stdin")
+	ErrorPasswordRequired    = errors.New("no password given. Run from a terminal to be prompted or pass --password-stdin")
+	ErrorPasswordMismatch    = errors.New("passwords do not match")
+	ErrorPasswordEmpty       = errors.New("password cannot be empty")
+	ErrorPasswordSources     = usageError{errors.New("--password and --password-stdin cannot be used together")}
+)
+
+// passwordFlags are the password flags shared by login and register
+type passwordFlags struct {
+	Password string
+	// Given is set when --password was passed, even as an empty string
+	Given bool
+	// Stdin reads the password from the first line of the input
+	Stdin bool
+}
+
+func (p *passwordFlags) register(cmd *cobra.Command, usage string) {
+	cmd.Flags().StringVarP(&p.Password, "password", "p", "", usage+". Visible in shell history and ps, prefer the prompt or --password-stdin")
+	cmd.Flags().BoolVarP(&p.Stdin, "password-stdin", "", false, "read the password from the first line of stdin")
+}
+
+// read returns the password from --password, in or a prompt on the terminal
+// of env that does not echo. With confirm set the prompt asks twice
+func (p *passwordFlags) read(env *cliEnv, in io.Reader, confirm bool) (string, error) {
+	if p.Given && p.Stdin {
+		return "", ErrorPasswordSources
+	}
+	switch {
+	case p.Given:
+		if strictSecrets() {
+			return "", ErrorPasswordFlagRefused
+		}
+		if p.Password == "" {
+			return "", ErrorPasswordEmpty
+		}
+		return p.Password, nil
+	case p.Stdin:
+		line, err := bufio.NewReader(in).ReadString('\n')
+		if err != nil && !errors.Is(err, io.EOF) {
+			return "", err
+		}
+		password := strings.TrimRight(line, "\r\n")
+		if password == "" {
+			return "", ErrorPasswordEmpty
+		}
+		return password, nil
+	}
+
+	password, err := env.promptSecret("password: ")
+	if err != nil {
+		return "", err
+	}
+	if password == "" {
+		return "", ErrorPasswordEmpty
+	}
+	if confirm {
+		again, err := env.promptSecret("confirm password: ")
+		if err != nil {
+			return "", err
+		}
+		if again != password {
+			return "", ErrorPasswordMismatch
+		}
+	}
+	return password, nil
+}
+
+// strictSecrets reports whether BOXEE_STRICT_SECRETS is set to a true value
+func strictSecrets() bool {
+	switch strings.ToLower(os.Getenv(strictSecretsEnvName)) {
+	case "", "0", "false", "no":
+		return false
+	}
+	return true
+}
+
+// commonPasswords are refused by checkPasswordStrength whatever their length
+var commonPasswords = map[string]bool{
+	"password": true, "password1": true, "password123": true, "123456789": true, "1234567890": true,
+	"qwertyuiop": true, "iloveyou": true, "letmein": true, "welcome1": true, "boxee": true, "boxee123": true,
+}
+
+// checkPasswordStrength asks for at least 10 characters from three of lower
+// case, upper case, digits and symbols, and rejects common passwords and
+// passwords containing the email name
+func checkPasswordStrength(password, email string) error {
+	var problems []string
+	if len([]rune(password)) < 10 {
+		problems = append(problems, "use at least 10 characters")
+	}
+	var lower, upper, digit, symbol bool
+	for _, r := range password {
+		switch {
+		case unicode.IsLower(r):
+			lower = true
+		case unicode.IsUpper(r):
+			upper = true
+		case unicode.IsDigit(r):
+			digit = true
+		default:
+			symbol = true
+		}
+	}
+	classes := 0
+	for _, has := range []bool{lower, upper, digit, symbol} {
+		if has {
+			classes++
+		}
+	}
+	if classes < 3 {
+		problems = append(problems, "mix at least three of lower case, upper case, digits and symbols")
+	}
+	if commonPasswords[strings.ToLower(password)] {
+		problems = append(problems, "avoid common passwords")
+	}
+	if name := strings.ToLower(strings.SplitN(email, "@", 2)[0]); len(name) >= 3 && strings.Contains(strings.ToLower(password), name) {
+		problems = append(problems, "do not include your email name")
+	}
+	if len(problems) > 0 {
+		return fmt.Errorf("password too weak: %v. Pass --skip-strength-check to use it anyway", strings.Join(problems, ", "))
+	}
+	return nil
+}
+
+// confirm asks a yes or no question, defaulting to no
+func confirm(in io.Reader, out io.Writer, question string) bool {
+	fmt.Fprint(out, question)
+	answer, _ := bufio.NewReader(in).ReadString('\n')
+	answer = strings.ToLower(strings.TrimSpace(answer))
+	return answer == "y" || answer == "yes"
+}
+
+// promptSecret reads a line from the terminal without echoing it. It fails
+// with ErrorPasswordRequired when stdin is not a terminal
+func (e *cliEnv) promptSecret(prompt string) (string, error) {
+	in, ok := e.terminalIn()
+	if !ok {
+		return "", ErrorPasswordRequired
+	}
+	fmt.Fprint(e.Stderr, prompt)
+	secret, err := term.ReadPassword(int(in.Fd()))
+	fmt.Fprintln(e.Stderr)
+	if err != nil {
+		return "", err
+	}
+	return string(secret), nil
+}
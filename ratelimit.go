@@ -0,0 +1,178 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/epuerta9/box-ee-cli/pkg/boxee"
+)
+
+// rateLimitConfig configures the client side token bucket. An rps of 0 leaves
+// requests unpaced until the server answers 429
+type rateLimitConfig struct {
+	RPS   float64 `yaml:"rps"`
+	Burst int     `yaml:"burst"`
+}
+
+// rateLimiter is a token bucket shared by every request of the run, so the
+// workers of bulk commands draw from one budget. A 429 halves the rate and
+// honors Retry-After, successful requests then raise it again slowly
+type rateLimiter struct {
+	mu          sync.Mutex
+	ceiling     float64
+	rate        float64
+	burst       float64
+	tokens      float64
+	last        time.Time
+	pausedUntil time.Time
+
+	first     time.Time
+	requests  int
+	throttled int
+}
+
+// sharedRateLimiter returns the limiter of the run, replacing it when the
+// configuration changes
+func (s *runState) sharedRateLimiter(cfg rateLimitConfig) *rateLimiter {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.limiter == nil || s.limiterCfg != cfg {
+		s.limiter = newRateLimiter(cfg)
+		s.limiterCfg = cfg
+	}
+	return s.limiter
+}
+
+func newRateLimiter(cfg rateLimitConfig) *rateLimiter {
+	burst := float64(cfg.Burst)
+	if burst < 1 {
+		burst = math.Max(1, math.Ceil(cfg.RPS))
+	}
+	return &rateLimiter{
+		ceiling: cfg.RPS,
+		rate:    cfg.RPS,
+		burst:   burst,
+		tokens:  burst,
+	}
+}
+
+// wait blocks until a request may be sent
+func (l *rateLimiter) wait(ctx context.Context) error {
+	for {
+		l.mu.Lock()
+		now := time.Now()
+		if l.first.IsZero() {
+			l.first = now
+		}
+		var delay time.Duration
+		switch {
+		case now.Before(l.pausedUntil):
+			delay = l.pausedUntil.Sub(now)
+		case l.rate <= 0:
+			l.requests++
+			l.mu.Unlock()
+			return nil
+		default:
+			if !l.last.IsZero() {
+				l.tokens = math.Min(l.burst, l.tokens+now.Sub(l.last).Seconds()*l.rate)
+			}
+			l.last = now
+			if l.tokens >= 1 {
+				l.tokens--
+				l.requests++
+				l.mu.Unlock()
+				return nil
+			}
+			delay = time.Duration((1 - l.tokens) / l.rate * float64(time.Second))
+		}
+		l.mu.Unlock()
+		if err := sleepContext(ctx, delay); err != nil {
+			return err
+		}
+	}
+}
+
+// observe adapts the rate to the response of a request
+func (l *rateLimiter) observe(resp *http.Response) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if resp.StatusCode != http.StatusTooManyRequests {
+		if l.rate > 0 && (l.ceiling <= 0 || l.rate < l.ceiling) {
+			l.rate += 0.5
+			if l.ceiling > 0 && l.rate > l.ceiling {
+				l.rate = l.ceiling
+			}
+		}
+		return
+	}
+	l.throttled++
+	if l.rate <= 0 {
+		//unpaced so far, start from half the throughput reached
+		l.rate = l.observedRate()
+		l.last = time.Now()
+		l.tokens = 0
+	}
+	l.rate = math.Max(l.rate/2, 0.5)
+	if after, ok := retryAfter(resp); ok {
+		if until := time.Now().Add(after); until.After(l.pausedUntil) {
+			l.pausedUntil = until
+		}
+	}
+}
+
+// observedRate is the number of requests per second since the first one
+func (l *rateLimiter) observedRate() float64 {
+	elapsed := time.Since(l.first).Seconds()
+	if elapsed <= 0 {
+		return float64(l.requests)
+	}
+	return float64(l.requests) / elapsed
+}
+
+// report writes the effective throughput of the requests sent so far
+func (l *rateLimiter) report(w io.Writer) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.requests == 0 {
+		return
+	}
+	elapsed := time.Since(l.first)
+	fmt.Fprintf(w, "%d requests in %v (%.1f req/s)", l.requests, elapsed.Round(time.Millisecond), l.observedRate())
+	if l.throttled > 0 {
+		fmt.Fprintf(w, ", throttled %d times by the server, rate lowered to %.1f req/s", l.throttled, l.rate)
+	}
+	fmt.Fprintln(w)
+}
+
+// reportThroughput writes the throughput of the limiter of the run, bulk
+// commands call it at the end
+func (s *runState) reportThroughput(w io.Writer) {
+	s.mu.Lock()
+	l := s.limiter
+	s.mu.Unlock()
+	if l != nil {
+		l.report(w)
+	}
+}
+
+// rateLimitedDoer waits for the limiter before every request
+type rateLimitedDoer struct {
+	next    boxee.HttpRequestDoer
+	limiter *rateLimiter
+}
+
+func (d *rateLimitedDoer) Do(req *http.Request) (*http.Response, error) {
+	if err := d.limiter.wait(req.Context()); err != nil {
+		return nil, err
+	}
+	resp, err := d.next.Do(req)
+	if err == nil {
+		d.limiter.observe(resp)
+	}
+	return resp, err
+}
@@ -0,0 +1,78 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestRateLimiterObserve(t *testing.T) {
+	throttled := &http.Response{StatusCode: http.StatusTooManyRequests, Header: http.Header{}}
+	ok := &http.Response{StatusCode: http.StatusOK, Header: http.Header{}}
+	cases := []struct {
+		name      string
+		cfg       rateLimitConfig
+		responses []*http.Response
+		wantRate  float64
+	}{
+		{name: "429 halves the rate", cfg: rateLimitConfig{RPS: 8}, responses: []*http.Response{throttled}, wantRate: 4},
+		{name: "429s keep halving", cfg: rateLimitConfig{RPS: 8}, responses: []*http.Response{throttled, throttled}, wantRate: 2},
+		{name: "rate stays above the floor", cfg: rateLimitConfig{RPS: 0.6}, responses: []*http.Response{throttled}, wantRate: 0.5},
+		{name: "successes raise the rate", cfg: rateLimitConfig{RPS: 8}, responses: []*http.Response{throttled, ok, ok}, wantRate: 5},
+		{name: "successes stop at the configured rps", cfg: rateLimitConfig{RPS: 8}, responses: []*http.Response{throttled, ok, ok, ok, ok, ok, ok, ok, ok, ok}, wantRate: 8},
+		{name: "unpaced stays unpaced without 429", cfg: rateLimitConfig{}, responses: []*http.Response{ok, ok}, wantRate: 0},
+	}
+	for _, c := range cases {
+		l := newRateLimiter(c.cfg)
+		for _, resp := range c.responses {
+			l.observe(resp)
+		}
+		if l.rate != c.wantRate {
+			t.Errorf("%v: rate %v, want %v", c.name, l.rate, c.wantRate)
+		}
+		if l.throttled > 0 && l.rate <= 0 {
+			t.Errorf("%v: limiter is unpaced after %d 429s", c.name, l.throttled)
+		}
+	}
+}
+
+func TestRateLimiterSlowsDownOn429(t *testing.T) {
+	ctx := context.Background()
+	l := newRateLimiter(rateLimitConfig{})
+	for i := 0; i < 5; i++ {
+		if err := l.wait(ctx); err != nil {
+			t.Fatal(err)
+		}
+	}
+	throttled := &http.Response{StatusCode: http.StatusTooManyRequests, Header: http.Header{"Retry-After": {"1"}}}
+	l.observe(throttled)
+	if l.rate <= 0 {
+		t.Fatal("limiter is still unpaced after a 429")
+	}
+	if wait := time.Until(l.pausedUntil); wait < 900*time.Millisecond {
+		t.Fatalf("paused for %v after Retry-After: 1, want about 1s", wait)
+	}
+
+	//a cancelled wait returns instead of sleeping out the pause
+	cancelled, cancel := context.WithCancel(ctx)
+	cancel()
+	if err := l.wait(cancelled); err == nil {
+		t.Fatal("wait during a Retry-After pause ignored the cancelled context")
+	}
+}
+
+func TestRateLimiterPacesRequests(t *testing.T) {
+	ctx := context.Background()
+	l := newRateLimiter(rateLimitConfig{RPS: 50, Burst: 1})
+	start := time.Now()
+	for i := 0; i < 6; i++ {
+		if err := l.wait(ctx); err != nil {
+			t.Fatal(err)
+		}
+	}
+	//the first request uses the burst, the other five wait 20ms each
+	if elapsed := time.Since(start); elapsed < 90*time.Millisecond {
+		t.Fatalf("6 requests at 50 rps took %v, want at least 100ms", elapsed)
+	}
+}
@@ -0,0 +1,178 @@
+package main
+
+import (
+	"context"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math/rand"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/epuerta9/box-ee-cli/pkg/boxee"
+)
+
+// retryPolicy configures the retryingDoer
+type retryPolicy struct {
+	MaxRetries int           `yaml:"max_retries"`
+	BaseDelay  time.Duration `yaml:"base_delay"`
+	MaxDelay   time.Duration `yaml:"max_delay"`
+	Post       bool          `yaml:"post"`
+}
+
+// retryingDoer retries transient failures with exponential backoff and full
+// jitter. Only GET, HEAD and DELETE are retried unless the policy opts POST in
+type retryingDoer struct {
+	next   boxee.HttpRequestDoer
+	policy retryPolicy
+	log    io.Writer
+	sleep  func(ctx context.Context, d time.Duration) error
+
+	mu  sync.Mutex
+	rnd *rand.Rand
+}
+
+func newRetryingDoer(next boxee.HttpRequestDoer, policy retryPolicy, log io.Writer) *retryingDoer {
+	return &retryingDoer{
+		next:   next,
+		policy: policy,
+		log:    log,
+		sleep:  sleepContext,
+		rnd:    rand.New(rand.NewSource(time.Now().UnixNano())),
+	}
+}
+
+func (d *retryingDoer) Do(req *http.Request) (*http.Response, error) {
+	if !d.retryable(req) {
+		return d.next.Do(req)
+	}
+	for attempt := 0; ; attempt++ {
+		resp, err := d.next.Do(req)
+		if attempt >= d.policy.MaxRetries || !transient(req, resp, err) {
+			return resp, err
+		}
+		delay := d.backoff(attempt)
+		var reason string
+		if err != nil {
+			reason = err.Error()
+		} else {
+			reason = resp.Status
+			if after, ok := retryAfter(resp); ok {
+				//a server asking for a longer pause than we are willing to
+				//wait gets its response back instead
+				if after > d.policy.MaxDelay {
+					return resp, nil
+				}
+				if after > delay {
+					delay = after
+				}
+			}
+			io.Copy(ioutil.Discard, resp.Body)
+			resp.Body.Close()
+		}
+		if d.log != nil {
+			fmt.Fprintf(d.log, "retrying %v %v in %v (%v)\n", req.Method, req.URL.Path, delay.Round(time.Millisecond), reason)
+		}
+		if err := d.sleep(req.Context(), delay); err != nil {
+			return nil, err
+		}
+		if req.Body != nil {
+			body, err := req.GetBody()
+			if err != nil {
+				return nil, err
+			}
+			req.Body = body
+		}
+	}
+}
+
+// retryable reports whether the request may be sent more than once
+func (d *retryingDoer) retryable(req *http.Request) bool {
+	if d.policy.MaxRetries <= 0 {
+		return false
+	}
+	if req.Body != nil && req.GetBody == nil {
+		return false
+	}
+	switch req.Method {
+	case http.MethodGet, http.MethodHead, http.MethodDelete:
+		return true
+	case http.MethodPost:
+		return d.policy.Post
+	}
+	return false
+}
+
+// backoff returns a random delay between 0 and BaseDelay*2^attempt, capped at MaxDelay
+func (d *retryingDoer) backoff(attempt int) time.Duration {
+	ceiling := d.policy.MaxDelay
+	if attempt < 32 {
+		if exp := d.policy.BaseDelay << uint(attempt); exp > 0 && exp < ceiling {
+			ceiling = exp
+		}
+	}
+	if ceiling <= 0 {
+		return 0
+	}
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return time.Duration(d.rnd.Int63n(int64(ceiling)))
+}
+
+// transient reports whether a failed attempt is worth repeating
+func transient(req *http.Request, resp *http.Response, err error) bool {
+	if err != nil {
+		if req.Context().Err() != nil {
+			return false
+		}
+		//certificate problems will not go away by themselves
+		var unknownAuthority x509.UnknownAuthorityError
+		var hostname x509.HostnameError
+		var invalid x509.CertificateInvalidError
+		if errors.As(err, &unknownAuthority) || errors.As(err, &hostname) || errors.As(err, &invalid) {
+			return false
+		}
+		//neither will a request missing from a replayed cassette
+		return !errors.Is(err, ErrorNoReplay)
+	}
+	switch resp.StatusCode {
+	case http.StatusTooManyRequests, http.StatusInternalServerError, http.StatusBadGateway,
+		http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+		return true
+	}
+	return false
+}
+
+// retryAfter parses the Retry-After header, given in seconds or as a date
+func retryAfter(resp *http.Response) (time.Duration, bool) {
+	value := resp.Header.Get("Retry-After")
+	if value == "" {
+		return 0, false
+	}
+	if seconds, err := strconv.Atoi(value); err == nil && seconds >= 0 {
+		return time.Duration(seconds) * time.Second, true
+	}
+	if at, err := http.ParseTime(value); err == nil {
+		d := time.Until(at)
+		if d < 0 {
+			d = 0
+		}
+		return d, true
+	}
+	return 0, false
+}
+
+func sleepContext(ctx context.Context, d time.Duration) error {
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-t.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
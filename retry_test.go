@@ -0,0 +1,99 @@
+package main
+
+import (
+	"context"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+)
+
+// statusDoer answers requests with statuses in order and counts the calls
+type statusDoer struct {
+	statuses []int
+	calls    int
+}
+
+func (d *statusDoer) Do(req *http.Request) (*http.Response, error) {
+	status := d.statuses[len(d.statuses)-1]
+	if d.calls < len(d.statuses) {
+		status = d.statuses[d.calls]
+	}
+	d.calls++
+	return &http.Response{
+		StatusCode: status,
+		Status:     http.StatusText(status),
+		Header:     http.Header{},
+		Body:       ioutil.NopCloser(strings.NewReader("")),
+	}, nil
+}
+
+func TestRetryingDoer(t *testing.T) {
+	cases := []struct {
+		name       string
+		method     string
+		post       bool
+		statuses   []int
+		wantCalls  int
+		wantStatus int
+	}{
+		{name: "get success", method: http.MethodGet, statuses: []int{200}, wantCalls: 1, wantStatus: 200},
+		{name: "get 503 then success", method: http.MethodGet, statuses: []int{503, 200}, wantCalls: 2, wantStatus: 200},
+		{name: "get 429 then success", method: http.MethodGet, statuses: []int{429, 429, 200}, wantCalls: 3, wantStatus: 200},
+		{name: "get gives up", method: http.MethodGet, statuses: []int{500}, wantCalls: 4, wantStatus: 500},
+		{name: "get 404 not retried", method: http.MethodGet, statuses: []int{404}, wantCalls: 1, wantStatus: 404},
+		{name: "delete 502 then success", method: http.MethodDelete, statuses: []int{502, 200}, wantCalls: 2, wantStatus: 200},
+		{name: "post not retried", method: http.MethodPost, statuses: []int{503, 200}, wantCalls: 1, wantStatus: 503},
+		{name: "post 429 not retried", method: http.MethodPost, statuses: []int{429, 200}, wantCalls: 1, wantStatus: 429},
+		{name: "post opted in", method: http.MethodPost, post: true, statuses: []int{503, 200}, wantCalls: 2, wantStatus: 200},
+	}
+	for _, c := range cases {
+		next := &statusDoer{statuses: c.statuses}
+		d := newRetryingDoer(next, retryPolicy{MaxRetries: 3, BaseDelay: time.Millisecond, MaxDelay: 5 * time.Millisecond, Post: c.post}, nil)
+		d.sleep = func(ctx context.Context, delay time.Duration) error { return nil }
+		var body io.Reader
+		if c.method == http.MethodPost {
+			body = strings.NewReader(`{"tracking_number":"1Z999AA10123456784"}`)
+		}
+		req, err := http.NewRequest(c.method, "http://boxee.test/api/v1/trackings", body)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp, err := d.Do(req)
+		if err != nil {
+			t.Fatalf("%v: %v", c.name, err)
+		}
+		if next.calls != c.wantCalls || resp.StatusCode != c.wantStatus {
+			t.Errorf("%v: %d calls ending in %d, want %d calls ending in %d", c.name, next.calls, resp.StatusCode, c.wantCalls, c.wantStatus)
+		}
+	}
+}
+
+func TestRetryAfterAboveMaxDelay(t *testing.T) {
+	next := &statusDoer{statuses: []int{429, 200}}
+	withRetryAfter := doerFunc(func(req *http.Request) (*http.Response, error) {
+		resp, err := next.Do(req)
+		if resp.StatusCode == http.StatusTooManyRequests {
+			resp.Header.Set("Retry-After", "60")
+		}
+		return resp, err
+	})
+	d := newRetryingDoer(withRetryAfter, retryPolicy{MaxRetries: 3, BaseDelay: time.Millisecond, MaxDelay: time.Second}, nil)
+	d.sleep = func(ctx context.Context, delay time.Duration) error { return nil }
+	req, _ := http.NewRequest(http.MethodGet, "http://boxee.test/api/v1/devices", nil)
+	resp, err := d.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.StatusCode != http.StatusTooManyRequests || next.calls != 1 {
+		t.Errorf("%d calls ending in %d, want the 429 back after 1 call", next.calls, resp.StatusCode)
+	}
+}
+
+type doerFunc func(req *http.Request) (*http.Response, error)
+
+func (f doerFunc) Do(req *http.Request) (*http.Response, error) {
+	return f(req)
+}
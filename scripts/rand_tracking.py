@@ -1,6 +1,11 @@
 import os
 import random
+import tempfile
 
-for i in range(40):
-    num = random.randrange(10000,11000)
-    os.system(f"boxee tracking add --tracking-number {num}")
\ No newline at end of file
+# write the tracking numbers to a file so boxee paces them with one rate limiter
+with tempfile.NamedTemporaryFile("w", suffix=".txt", delete=False) as f:
+    for i in range(40):
+        f.write(f"{random.randrange(10000,11000)}\n")
+
+os.system(f"boxee tracking file -f {f.name} --rps 5")
+os.remove(f.name)
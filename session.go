@@ -0,0 +1,257 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/epuerta9/box-ee-cli/pkg/boxee"
+	"github.com/spf13/cobra"
+)
+
+// annotationSession marks commands authenticated with the session token from
+// boxee login. It is inherited by subcommands
+const annotationSession = "boxee/session"
+
+var (
+	ErrSessionExpired = fmt.Errorf("%w: session expired or revoked. Run boxee login to sign in again", boxee.ErrUnauthorized)
+	ErrNotLoggedIn    = fmt.Errorf("%w: not logged in. Run boxee login first", boxee.ErrUnauthorized)
+	ErrorRerunCommand = errors.New("logged in again, but the command already read its input from stdin. Run it again")
+)
+
+// sessionAnnotations is set on command groups that need a session
+var sessionAnnotations = map[string]string{annotationSession: "true"}
+
+// usesSession reports whether cmd or one of its parents needs a session
+func usesSession(cmd *cobra.Command) bool {
+	for c := cmd; c != nil; c = c.Parent() {
+		if c.Annotations[annotationSession] == "true" {
+			return true
+		}
+	}
+	return false
+}
+
+// whoamiResult is the output of boxee whoami
+type whoamiResult struct {
+	Email      string `json:"email"`
+	Server     string `json:"server"`
+	Context    string `json:"context,omitempty"`
+	LoggedInAt string `json:"logged_in_at,omitempty"`
+	TokenAge   string `json:"token_age"`
+	Valid      bool   `json:"valid"`
+}
+
+// whoamiOptions are the options of boxee whoami
+type whoamiOptions struct {
+	cmdDeps
+}
+
+func newWhoamiOptions(deps cmdDeps) *whoamiOptions {
+	return &whoamiOptions{cmdDeps: deps}
+}
+
+func (o *whoamiOptions) Run(ctx context.Context) error {
+	api, cParams, err := o.Clients.SessionClient()
+	if err != nil {
+		return err
+	}
+	//listing a single device is the cheapest authenticated call
+	if _, err := api.Devices.List(ctx, boxee.ListOptions{Limit: 1}); err != nil {
+		return err
+	}
+	result := whoamiResult{
+		Email:    cParams.Email,
+		Server:   cParams.Address,
+		Context:  cParams.Context,
+		TokenAge: "unknown",
+		Valid:    true,
+	}
+	if issued, err := o.state.readCredential(cParams, credSessionIssued); err == nil && issued != "" {
+		if at, err := time.Parse(time.RFC3339, issued); err == nil {
+			result.LoggedInAt = at.Format(time.RFC3339)
+			result.TokenAge = time.Since(at).Round(time.Second).String()
+		}
+	}
+	return o.print(result)
+}
+
+func getWhoamiCmd(deps cmdDeps) *cobra.Command {
+	o := newWhoamiOptions(deps)
+	return &cobra.Command{
+		Use:         "whoami",
+		Short:       "show the logged in account",
+		Long:        `check the session token against the server and show the account, server and token age`,
+		Annotations: sessionAnnotations,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return o.Run(cmd.Context())
+		},
+	}
+}
+
+// logoutResult is a row of boxee logout
+type logoutResult struct {
+	Store  string `json:"store"`
+	Status string `json:"status"`
+}
+
+// logoutOptions are the options of boxee logout
+type logoutOptions struct {
+	cmdDeps
+}
+
+func newLogoutOptions(deps cmdDeps) *logoutOptions {
+	return &logoutOptions{cmdDeps: deps}
+}
+
+func (o *logoutOptions) Run(ctx context.Context) error {
+	cParams, err := o.Config()
+	if err != nil {
+		return err
+	}
+	results, err := o.state.wipeSession(cParams)
+	if printErr := o.print(results); printErr != nil {
+		return printErr
+	}
+	return err
+}
+
+func getLogoutCmd(deps cmdDeps) *cobra.Command {
+	o := newLogoutOptions(deps)
+	return &cobra.Command{
+		Use:   "logout",
+		Short: "remove the session token",
+		Long: `
+		remove the session token of the current account from the os keyring, the encrypted credential file
+		and the config files, wherever it is stored`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return o.Run(cmd.Context())
+		},
+	}
+}
+
+// wipeSession deletes the session token and its issue time from every store
+func (s *runState) wipeSession(cParams ConfigParams) ([]logoutResult, error) {
+	names := []string{credentialName(cParams, credSessionToken), credentialName(cParams, credSessionIssued)}
+	var results []logoutResult
+	var failed []string
+	remove := func(store string, cs credentialStore) {
+		found := false
+		for _, name := range names {
+			if _, err := cs.Get(name); errors.Is(err, ErrCredentialNotFound) {
+				continue
+			} else if err != nil {
+				results = append(results, logoutResult{Store: store, Status: "failed: " + err.Error()})
+				failed = append(failed, store)
+				return
+			}
+			if err := cs.Delete(name); err != nil {
+				results = append(results, logoutResult{Store: store, Status: "failed: " + err.Error()})
+				failed = append(failed, store)
+				return
+			}
+			found = true
+		}
+		status := "not found"
+		if found {
+			status = "removed"
+		}
+		results = append(results, logoutResult{Store: store, Status: status})
+	}
+
+	if keyringAvailable() {
+		remove(storeKeyring, keyringStore{})
+	}
+	file, err := s.newCredentialStore(storeFile)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := os.Stat(file.(*fileStore).path); err == nil {
+		remove(storeFile, file)
+	}
+
+	//tokens kept in plaintext may sit in any config file, under credentials
+	//or at the top level from before the credential store existed
+	plainFound := false
+	for _, key := range []string{"credentials." + names[0], "credentials." + names[1], credSessionToken} {
+		l, ok := s.config.origin(key)
+		if !ok || (l.Source != layerSystem && l.Source != layerUser && l.Source != layerProject) {
+			continue
+		}
+		_, path, _ := lookupConfigKey(key)
+		err := editConfigFileAt(l.Origin, func(settings map[string]interface{}) error {
+			unsetPath(settings, path)
+			return nil
+		})
+		if err != nil {
+			results = append(results, logoutResult{Store: storePlaintext + " " + filepath.Base(l.Origin), Status: "failed: " + err.Error()})
+			failed = append(failed, l.Origin)
+			continue
+		}
+		plainFound = true
+	}
+	status := "not found"
+	if plainFound {
+		status = "removed"
+	}
+	results = append(results, logoutResult{Store: storePlaintext, Status: status})
+
+	if len(failed) > 0 {
+		return results, fmt.Errorf("unable to remove the session token from %v", strings.Join(failed, ", "))
+	}
+	return results, nil
+}
+
+// stdinTracker records whether a command read its input, which a rerun
+// after logging in again could not read a second time
+type stdinTracker struct {
+	io.Reader
+	read bool
+}
+
+func (t *stdinTracker) Read(p []byte) (int, error) {
+	t.read = true
+	return t.Reader.Read(p)
+}
+
+// handleExpiredSession runs when the session command cmd failed with a 401. On
+// a terminal it offers to log in again and reruns cmd with the flags and
+// arguments already parsed, otherwise it returns ErrSessionExpired. A command
+// that consumed stdin is not rerun, the user is asked to run it again instead
+func handleExpiredSession(ctx context.Context, deps cmdDeps, cmd *cobra.Command, stdinRead bool) error {
+	if _, ok := deps.state.env.terminalIn(); !ok || !isTerminal(deps.ErrOut) || cmd.RunE == nil {
+		return ErrSessionExpired
+	}
+	cParams, err := deps.Config()
+	if err != nil {
+		return ErrSessionExpired
+	}
+	if !confirm(deps.In, deps.ErrOut, fmt.Sprintf("session expired. Log in again as %v? [y/N] ", cParams.Email)) {
+		return ErrSessionExpired
+	}
+	password, err := deps.state.env.promptSecret("password: ")
+	if err != nil {
+		return err
+	}
+	if _, err := loginSession(ctx, deps, cParams, password); err != nil {
+		return err
+	}
+	if stdinRead {
+		return ErrorRerunCommand
+	}
+	err = cmd.RunE(cmd, cmd.Flags().Args())
+	if errors.Is(err, boxee.ErrUnauthorized) {
+		return ErrSessionExpired
+	}
+	return err
+}
+
+// sessionIssuedNow is stored next to the session token to report its age
+func sessionIssuedNow() string {
+	return time.Now().UTC().Format(time.RFC3339)
+}
@@ -0,0 +1,119 @@
+package main
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// tlsConfig holds the tls settings of a context
+type tlsConfig struct {
+	CAFile             string `yaml:"ca_file"`
+	CADir              string `yaml:"ca_dir"`
+	CertFile           string `yaml:"cert_file"`
+	KeyFile            string `yaml:"key_file"`
+	MinVersion         string `yaml:"min_version"`
+	ServerName         string `yaml:"server_name"`
+	InsecureSkipVerify bool   `yaml:"insecure_skip_verify"`
+}
+
+var tlsVersions = map[string]uint16{
+	"1.0": tls.VersionTLS10,
+	"1.1": tls.VersionTLS11,
+	"1.2": tls.VersionTLS12,
+	"1.3": tls.VersionTLS13,
+}
+
+func validateTLSVersion(value string) error {
+	if _, ok := tlsVersions[value]; !ok {
+		return errors.New("must be one of 1.0, 1.1, 1.2, 1.3")
+	}
+	return nil
+}
+
+// expandHome replaces a leading ~/ with the home directory
+func expandHome(path string) string {
+	if !strings.HasPrefix(path, "~/") {
+		return path
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return path
+	}
+	return filepath.Join(home, path[2:])
+}
+
+// isZero reports whether no tls setting was made, in which case the default
+// transport is used as is
+func (c tlsConfig) isZero() bool {
+	return c == tlsConfig{}
+}
+
+// build returns the crypto/tls config for the settings. CA certificates are
+// trusted in addition to the system roots
+func (c tlsConfig) build() (*tls.Config, error) {
+	c.CAFile, c.CADir = expandHome(c.CAFile), expandHome(c.CADir)
+	c.CertFile, c.KeyFile = expandHome(c.CertFile), expandHome(c.KeyFile)
+	cfg := &tls.Config{
+		MinVersion:         tls.VersionTLS12,
+		ServerName:         c.ServerName,
+		InsecureSkipVerify: c.InsecureSkipVerify,
+	}
+	if c.MinVersion != "" {
+		v, ok := tlsVersions[c.MinVersion]
+		if !ok {
+			return nil, fmt.Errorf("invalid tls.min_version %v: %w", c.MinVersion, validateTLSVersion(c.MinVersion))
+		}
+		cfg.MinVersion = v
+	}
+
+	if c.CAFile != "" || c.CADir != "" {
+		pool, err := x509.SystemCertPool()
+		if err != nil || pool == nil {
+			pool = x509.NewCertPool()
+		}
+		var files []string
+		if c.CAFile != "" {
+			files = append(files, c.CAFile)
+		}
+		if c.CADir != "" {
+			entries, err := ioutil.ReadDir(c.CADir)
+			if err != nil {
+				return nil, fmt.Errorf("reading tls.ca_dir: %w", err)
+			}
+			for _, e := range entries {
+				ext := strings.ToLower(filepath.Ext(e.Name()))
+				if !e.IsDir() && (ext == ".pem" || ext == ".crt" || ext == ".cer") {
+					files = append(files, filepath.Join(c.CADir, e.Name()))
+				}
+			}
+		}
+		for _, f := range files {
+			pem, err := ioutil.ReadFile(f)
+			if err != nil {
+				return nil, fmt.Errorf("reading CA certificate: %w", err)
+			}
+			if !pool.AppendCertsFromPEM(pem) {
+				return nil, fmt.Errorf("no PEM certificates found in %v", f)
+			}
+		}
+		cfg.RootCAs = pool
+	}
+
+	if c.CertFile != "" || c.KeyFile != "" {
+		if c.CertFile == "" || c.KeyFile == "" {
+			return nil, errors.New("tls.cert_file and tls.key_file must be set together")
+		}
+		cert, err := tls.LoadX509KeyPair(c.CertFile, c.KeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("loading client certificate: %w", err)
+		}
+		cfg.Certificates = []tls.Certificate{cert}
+	}
+	return cfg, nil
+}
@@ -0,0 +1,236 @@
+package main
+
+import (
+	"bytes"
+	"crypto/tls"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptrace"
+	"net/url"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/epuerta9/box-ee-cli/pkg/boxee"
+)
+
+const redacted = "REDACTED"
+
+// sensitiveHeaders are never written to a trace, keyed by canonical name
+var sensitiveHeaders = map[string]bool{
+	http.CanonicalHeaderKey(boxee.SessionHeader):   true,
+	http.CanonicalHeaderKey(boxee.ClientKeyHeader): true,
+	"Authorization":       true,
+	"Cookie":              true,
+	"Set-Cookie":          true,
+	"Proxy-Authorization": true,
+}
+
+// sensitiveFields are json fields and query parameters whose values are never
+// written to a trace
+var sensitiveFields = map[string]bool{
+	"password":      true,
+	"session_token": true,
+	"client_key":    true,
+	"pin_key":       true,
+	"pinkey":        true,
+}
+
+// traceDoer writes every request and response to w with their headers and
+// timings. Bodies are only written with bodies set, which --trace does
+type traceDoer struct {
+	next   boxee.HttpRequestDoer
+	w      io.Writer
+	bodies bool
+	// secretHeaders are redacted besides sensitiveHeaders, see extraHeaderNames
+	secretHeaders map[string]bool
+	mu            sync.Mutex
+	seq           int64
+}
+
+// traceTimings records the connection phases of one request
+type traceTimings struct {
+	start                     time.Time
+	dnsStart, dnsDone         time.Time
+	connectStart, connectDone time.Time
+	tlsStart, tlsDone         time.Time
+	firstByte                 time.Time
+	reused                    bool
+}
+
+func (d *traceDoer) Do(req *http.Request) (*http.Response, error) {
+	id := atomic.AddInt64(&d.seq, 1)
+	var t traceTimings
+	req = req.WithContext(httptrace.WithClientTrace(req.Context(), &httptrace.ClientTrace{
+		DNSStart:             func(httptrace.DNSStartInfo) { t.dnsStart = time.Now() },
+		DNSDone:              func(httptrace.DNSDoneInfo) { t.dnsDone = time.Now() },
+		ConnectStart:         func(string, string) { t.connectStart = time.Now() },
+		ConnectDone:          func(string, string, error) { t.connectDone = time.Now() },
+		TLSHandshakeStart:    func() { t.tlsStart = time.Now() },
+		TLSHandshakeDone:     func(tls.ConnectionState, error) { t.tlsDone = time.Now() },
+		GotConn:              func(info httptrace.GotConnInfo) { t.reused = info.Reused },
+		GotFirstResponseByte: func() { t.firstByte = time.Now() },
+	}))
+
+	var out bytes.Buffer
+	fmt.Fprintf(&out, "[%d] > %v %v\n", id, req.Method, redactURL(req.URL))
+	writeHeaders(&out, fmt.Sprintf("[%d] > ", id), redactHeaders(req.Header, d.secretHeaders))
+	if d.bodies {
+		if req.GetBody != nil {
+			if body, err := req.GetBody(); err == nil {
+				raw, _ := ioutil.ReadAll(body)
+				body.Close()
+				writeBody(&out, fmt.Sprintf("[%d] > ", id), raw)
+			}
+		}
+	}
+	d.write(out.Bytes())
+
+	t.start = time.Now()
+	resp, err := d.next.Do(req)
+	total := time.Since(t.start)
+	out.Reset()
+	if err != nil {
+		fmt.Fprintf(&out, "[%d] ! %v %v failed after %v: %v\n", id, req.Method, redactURL(req.URL), total.Round(time.Microsecond), err)
+		d.write(out.Bytes())
+		return resp, err
+	}
+	fmt.Fprintf(&out, "[%d] < %v in %v (%v)\n", id, resp.Status, total.Round(time.Microsecond), t.summary())
+	writeHeaders(&out, fmt.Sprintf("[%d] < ", id), redactHeaders(resp.Header, d.secretHeaders))
+	if d.bodies {
+		raw, readErr := ioutil.ReadAll(resp.Body)
+		resp.Body.Close()
+		resp.Body = ioutil.NopCloser(bytes.NewReader(raw))
+		if readErr != nil {
+			fmt.Fprintf(&out, "[%d] < body read failed: %v\n", id, readErr)
+		}
+		writeBody(&out, fmt.Sprintf("[%d] < ", id), raw)
+	}
+	d.write(out.Bytes())
+	return resp, nil
+}
+
+// write keeps the lines of concurrent requests from interleaving
+func (d *traceDoer) write(b []byte) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.w.Write(b)
+}
+
+func (t traceTimings) summary() string {
+	var parts []string
+	if t.reused {
+		parts = append(parts, "connection reused")
+	}
+	phase := func(name string, start, end time.Time) {
+		if !start.IsZero() && !end.IsZero() {
+			parts = append(parts, fmt.Sprintf("%v %v", name, end.Sub(start).Round(time.Microsecond)))
+		}
+	}
+	phase("dns", t.dnsStart, t.dnsDone)
+	phase("connect", t.connectStart, t.connectDone)
+	phase("tls", t.tlsStart, t.tlsDone)
+	phase("first byte", t.start, t.firstByte)
+	return strings.Join(parts, ", ")
+}
+
+func writeHeaders(w io.Writer, prefix string, h http.Header) {
+	var names []string
+	for name := range h {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		for _, v := range h[name] {
+			fmt.Fprintf(w, "%v%v: %v\n", prefix, name, v)
+		}
+	}
+}
+
+func writeBody(w io.Writer, prefix string, raw []byte) {
+	if len(raw) == 0 {
+		return
+	}
+	for _, line := range strings.Split(strings.TrimRight(string(redactBody(raw)), "\n"), "\n") {
+		fmt.Fprintf(w, "%v%v\n", prefix, line)
+	}
+}
+
+// extraHeaderNames returns the canonical names of the configured extra
+// headers. Their values often carry tokens, so they are redacted like the
+// auth headers
+func extraHeaderNames(headers map[string]string) map[string]bool {
+	names := map[string]bool{}
+	for name := range headers {
+		names[http.CanonicalHeaderKey(name)] = true
+	}
+	return names
+}
+
+// redactHeaders returns a copy of h with the values of sensitiveHeaders and
+// of the canonical names in extra replaced
+func redactHeaders(h http.Header, extra map[string]bool) http.Header {
+	clean := h.Clone()
+	for name := range clean {
+		canonical := http.CanonicalHeaderKey(name)
+		if sensitiveHeaders[canonical] || extra[canonical] {
+			clean[name] = []string{redacted}
+		}
+	}
+	return clean
+}
+
+// redactURL returns u as a string with sensitive query parameters replaced
+func redactURL(u *url.URL) string {
+	q := u.Query()
+	changed := false
+	for name := range q {
+		if sensitiveFields[strings.ToLower(name)] {
+			q[name] = []string{redacted}
+			changed = true
+		}
+	}
+	if !changed {
+		return u.String()
+	}
+	clean := *u
+	clean.RawQuery = q.Encode()
+	return clean.String()
+}
+
+// redactBody replaces sensitive fields of a json body. Bodies that are not
+// json are returned unchanged
+func redactBody(raw []byte) []byte {
+	var v interface{}
+	if err := json.Unmarshal(raw, &v); err != nil {
+		return raw
+	}
+	clean, err := json.Marshal(redactValue(v))
+	if err != nil {
+		return raw
+	}
+	return clean
+}
+
+func redactValue(v interface{}) interface{} {
+	switch v := v.(type) {
+	case map[string]interface{}:
+		for k, inner := range v {
+			if sensitiveFields[strings.ToLower(k)] {
+				v[k] = redacted
+				continue
+			}
+			v[k] = redactValue(inner)
+		}
+	case []interface{}:
+		for i, inner := range v {
+			v[i] = redactValue(inner)
+		}
+	}
+	return v
+}
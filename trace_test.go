@@ -0,0 +1,114 @@
+package main
+
+import (
+	"bytes"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/epuerta9/box-ee-cli/pkg/boxee"
+)
+
+func TestRedactHeaders(t *testing.T) {
+	extra := extraHeaderNames(map[string]string{"x-api-key": "s3cr3t-gateway-key"})
+	cases := []struct {
+		name  string
+		value string
+		want  string
+	}{
+		{name: "X-Api-Key", value: "s3cr3t-gateway-key", want: redacted},
+		{name: "x-api-key", value: "s3cr3t-gateway-key", want: redacted},
+		{name: boxee.SessionHeader, value: "sess_qa", want: redacted},
+		{name: boxee.ClientKeyHeader, value: "ck_qa", want: redacted},
+		{name: "x-boxee-auth", value: "sess_qa", want: redacted},
+		{name: "Authorization", value: "Bearer sk_live", want: redacted},
+		{name: "Set-Cookie", value: "session=abc", want: redacted},
+		{name: "Content-Type", value: "application/json", want: "application/json"},
+	}
+	for _, c := range cases {
+		h := http.Header{}
+		h[c.name] = []string{c.value}
+		clean := redactHeaders(h, extra)
+		if got := clean[c.name]; len(got) != 1 || got[0] != c.want {
+			t.Errorf("%v: %v, want %v", c.name, got, c.want)
+		}
+		if h[c.name][0] != c.value {
+			t.Errorf("%v: redactHeaders changed the original header", c.name)
+		}
+	}
+}
+
+func TestRedactBody(t *testing.T) {
+	cases := []struct {
+		name string
+		body string
+		want string
+	}{
+		{name: "password", body: `{"email":"qa@example.com","password":"Quiet-Harbor-52"}`, want: `{"email":"qa@example.com","password":"REDACTED"}`},
+		{name: "session token", body: `{"msg":"ok","session_token":"sess_qa"}`, want: `{"msg":"ok","session_token":"REDACTED"}`},
+		{name: "nested pin keys", body: `{"trackings":[{"id":"trk-0001","pin_key":"123456"}]}`, want: `{"trackings":[{"id":"trk-0001","pin_key":"REDACTED"}]}`},
+		{name: "field case", body: `{"Password":"x"}`, want: `{"Password":"REDACTED"}`},
+		{name: "not json", body: "password=x", want: "password=x"},
+	}
+	for _, c := range cases {
+		if got := string(redactBody([]byte(c.body))); got != c.want {
+			t.Errorf("%v: %v, want %v", c.name, got, c.want)
+		}
+	}
+}
+
+func TestRedactURL(t *testing.T) {
+	cases := []struct {
+		raw  string
+		want string
+	}{
+		{raw: "http://boxee.test/api/v1/client/validate?pinkey=123456", want: "http://boxee.test/api/v1/client/validate?pinkey=REDACTED"},
+		{raw: "http://boxee.test/api/v1/devices?page=2", want: "http://boxee.test/api/v1/devices?page=2"},
+	}
+	for _, c := range cases {
+		u, err := url.Parse(c.raw)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := redactURL(u); got != c.want {
+			t.Errorf("%v: %v, want %v", c.raw, got, c.want)
+		}
+	}
+}
+
+func TestTraceDoerRedacts(t *testing.T) {
+	next := doerFunc(func(req *http.Request) (*http.Response, error) {
+		return &http.Response{
+			StatusCode: http.StatusOK,
+			Status:     "200 OK",
+			Header:     http.Header{"Content-Type": {"application/json"}},
+			Body:       ioutil.NopCloser(strings.NewReader(`{"msg":"ok","session_token":"sess_secret"}`)),
+		}, nil
+	})
+	var out bytes.Buffer
+	d := &traceDoer{next: next, w: &out, bodies: true, secretHeaders: extraHeaderNames(map[string]string{"X-Api-Key": "s3cr3t-gateway-key"})}
+	req, err := http.NewRequest(http.MethodPost, "http://boxee.test/api/v1/admin/login", strings.NewReader(`{"email":"qa@example.com","password":"Quiet-Harbor-52"}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set(boxee.SessionHeader, "sess_old")
+	req.Header.Set("X-Api-Key", "s3cr3t-gateway-key")
+	resp, err := d.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, _ := ioutil.ReadAll(resp.Body)
+	if !strings.Contains(string(body), "sess_secret") {
+		t.Errorf("the caller got %s, want the unredacted body", body)
+	}
+	for _, secret := range []string{"sess_old", "Quiet-Harbor-52", "sess_secret", "s3cr3t-gateway-key"} {
+		if strings.Contains(out.String(), secret) {
+			t.Errorf("trace contains %v:\n%v", secret, out.String())
+		}
+	}
+	if !strings.Contains(out.String(), "qa@example.com") {
+		t.Errorf("trace lost the email:\n%v", out.String())
+	}
+}
@@ -1,266 +1,335 @@
 package main
 
 import (
-	"bufio"
 	"context"
-	"encoding/json"
 	"fmt"
-	"io/ioutil"
-	"net/http"
-	"os"
 
+	"github.com/epuerta9/box-ee-cli/pkg/boxee"
 	"github.com/spf13/cobra"
 )
 
-var (
-	trackingNumber string
-	trackingID     string
-	file           string
-)
+// importFailedError is returned by boxee tracking file when some tracking
+// numbers were not imported. The results were printed already
+type importFailedError struct {
+	failed, total int
+}
 
-func getTrackingCmd() *cobra.Command {
+func (e *importFailedError) Error() string {
+	return fmt.Sprintf("%d of %d tracking numbers failed to import. Rerun with --resume to retry them", e.failed, e.total)
+}
+
+func getTrackingCmd(deps cmdDeps) *cobra.Command {
 	//tracking root command. Hang all sub commands related to tracking off of this one
 	trackingCmd := &cobra.Command{
-		Use:   "tracking",
-		Short: "tracking actions command",
+		Use:         "tracking",
+		Short:       "tracking actions command",
+		Annotations: sessionAnnotations,
 		Long: `
-			The root command for tracking. Possible subcommands include add/list/delete/update`,
+			The root command for tracking. Possible subcommands include add/get/list/delete/file`,
 	}
 
 	//add sub commands
-	trackingCmd.AddCommand(trackingAdd())
-	trackingCmd.AddCommand(trackingList())
-	trackingCmd.AddCommand(trackingDelete())
-	trackingCmd.AddCommand(trackingAddFile())
+	trackingCmd.AddCommand(trackingAdd(deps))
+	trackingCmd.AddCommand(trackingGet(deps))
+	trackingCmd.AddCommand(trackingList(deps))
+	trackingCmd.AddCommand(trackingDelete(deps))
+	trackingCmd.AddCommand(trackingAddFile(deps))
 
 	return trackingCmd
 }
 
-func trackingAddFile() *cobra.Command {
+// trackingFileOptions are the options of boxee tracking file
+type trackingFileOptions struct {
+	cmdDeps
+	File        string
+	DeviceID    string
+	Concurrency int
+	// JournalPath defaults to File with a .journal suffix
+	JournalPath string
+	Resume      bool
+	// Force replaces an existing journal when not resuming
+	Force      bool
+	NoProgress bool
+}
+
+func newTrackingFileOptions(deps cmdDeps) *trackingFileOptions {
+	return &trackingFileOptions{cmdDeps: deps, Concurrency: 4}
+}
+
+func (o *trackingFileOptions) Run(ctx context.Context) error {
+	if err := checkEmptyFlags([]string{o.File}); err != nil {
+		return err
+	}
+	path := o.state.env.workPath(o.File)
+	lines, err := readImportFile(path)
+	if err != nil {
+		return err
+	}
+
+	api, _, err := o.Clients.SessionClient()
+	if err != nil {
+		return err
+	}
+
+	journalPath := o.JournalPath
+	if journalPath == "" {
+		journalPath = path + ".journal"
+	}
+	journal, done, err := openImportJournal(o.state.env.workPath(journalPath), o.Resume, o.Force)
+	if err != nil {
+		return err
+	}
+	defer journal.Close()
+
+	importer := &trackingImporter{
+		trackings:   api.Trackings,
+		deviceID:    o.DeviceID,
+		concurrency: o.Concurrency,
+		journal:     journal,
+	}
+	if !o.NoProgress && isTerminal(o.ErrOut) {
+		importer.progress = o.ErrOut
+	}
+	//results are printed as they complete, json output becomes NDJSON
+	streamer, err := newListStreamer(o.Out, o.state.flags.Output)
+	if err != nil {
+		return err
+	}
+	var printErr error
+	summary := importer.run(ctx, lines, done, func(r importResult) {
+		if printErr == nil {
+			printErr = streamer.Page([]importResult{r})
+		}
+	})
+	if printErr == nil {
+		printErr = streamer.Done([]importResult{})
+	}
+	if printErr != nil {
+		return printErr
+	}
+	fmt.Fprintf(o.ErrOut, "%d added, %d skipped, %d failed\n", summary.added, summary.skipped, summary.failed)
+	o.state.reportThroughput(o.ErrOut)
+
+	if summary.failed > 0 {
+		return &importFailedError{failed: summary.failed, total: summary.total()}
+	}
+	return nil
+}
+
+func trackingAddFile(deps cmdDeps) *cobra.Command {
+	o := newTrackingFileOptions(deps)
 	trackingfileCmd := &cobra.Command{
 		Use:   "file",
 		Short: "select tracking numbers file",
 		Long: `
-		add a tracking via file. Required flags include tracking name and tracking type`,
+		add tracking numbers from a file with one tracking number per line. Numbers are sent by a pool of
+		--concurrency workers and every accepted number is written to a journal. Each result is printed as
+		soon as it is known, json output has one object per line, and a summary goes to stderr at the end.
+		An interrupted import can be continued with --resume, which skips the numbers already in the journal
+		for the same device. An existing journal is only replaced with --force`,
 		RunE: func(cmd *cobra.Command, args []string) error {
-			//add a tracking
-			if err := checkEmptyFlags([]string{file}); err != nil {
-				return err
-			}
-			readConfig()
-			cParams := readValuesFromConfig()
-
-			readFile, err := os.Open(file)
-
-			if err != nil {
-				fmt.Println(err)
-			}
-			fileScanner := bufio.NewScanner(readFile)
-			fileScanner.Split(bufio.ScanLines)
-			var fileLines []string
-
-			for fileScanner.Scan() {
-				fileLines = append(fileLines, fileScanner.Text())
-			}
-
-			readFile.Close()
-
-			client, err := NewClient(cParams.Address)
-			if err != nil {
-				return err
-
-			}
-			ctx := context.TODO()
-
-			//check if device id is passed
-			var allResponses []StandardResponse
-
-			client.RequestEditors = append(client.RequestEditors, setBoxeeAuthHeaders(cParams.SessionToken))
-			for _, tn := range fileLines {
-				var payload TrackingRequestItem
-				var addResp StandardResponse
-				if deviceId == "" {
-					payload = TrackingRequestItem{
-						TrackingNumber: tn,
-					}
-				} else {
-					payload = TrackingRequestItem{
-						DeviceId:       &deviceId,
-						TrackingNumber: tn,
-					}
-				}
-				resp, err := client.AddTracking(ctx, payload)
-				if err != nil {
-					return err
-				}
-				body, _ := ioutil.ReadAll(resp.Body)
-				resp.Body.Close()
-				json.Unmarshal(body, &addResp)
-				allResponses = append(allResponses, addResp)
-			}
-
-			json.NewEncoder(os.Stdout).Encode(allResponses)
-			return nil
+			return o.Run(cmd.Context())
 		},
 	}
-	trackingfileCmd.Flags().StringVarP(&file, "file", "f", "", "specify a file")
-	trackingfileCmd.Flags().StringVarP(&deviceId, "device-id", "", "", "specify a device id")
+	trackingfileCmd.Flags().StringVarP(&o.File, "file", "f", "", "specify a file")
+	trackingfileCmd.Flags().StringVarP(&o.DeviceID, "device-id", "", "", "specify a device id")
+	trackingfileCmd.Flags().IntVarP(&o.Concurrency, "concurrency", "c", o.Concurrency, "number of tracking numbers to add in parallel")
+	trackingfileCmd.Flags().StringVarP(&o.JournalPath, "journal", "", "", "journal of imported tracking numbers (default <file>.journal)")
+	trackingfileCmd.Flags().BoolVarP(&o.Resume, "resume", "", false, "skip tracking numbers already recorded in the journal")
+	trackingfileCmd.Flags().BoolVarP(&o.Force, "force", "", false, "start over and replace an existing journal")
+	trackingfileCmd.Flags().BoolVarP(&o.NoProgress, "no-progress", "", false, "do not show the progress indicator")
 	trackingfileCmd.MarkFlagRequired("file")
 	return trackingfileCmd
 }
 
-func trackingAdd() *cobra.Command {
+// trackingAddOptions are the options of boxee tracking add
+type trackingAddOptions struct {
+	cmdDeps
+	TrackingNumber string
+	// DeviceID is optional, the server picks a device without it
+	DeviceID string
+}
+
+func newTrackingAddOptions(deps cmdDeps) *trackingAddOptions {
+	return &trackingAddOptions{cmdDeps: deps}
+}
+
+func (o *trackingAddOptions) Run(ctx context.Context) error {
+	if err := checkEmptyFlags([]string{o.TrackingNumber}); err != nil {
+		return err
+	}
+	api, _, err := o.Clients.SessionClient()
+	if err != nil {
+		return err
+	}
+	added, err := api.Trackings.Add(ctx, o.TrackingNumber, o.DeviceID)
+	if err != nil {
+		return err
+	}
+	return o.print(added)
+}
+
+func trackingAdd(deps cmdDeps) *cobra.Command {
+	o := newTrackingAddOptions(deps)
 	trackingAddCmd := &cobra.Command{
 		Use:   "add",
 		Short: "add a tracking",
 		Long: `
 		add a tracking. Required flags include tracking name and tracking type`,
 		RunE: func(cmd *cobra.Command, args []string) error {
-			//add a tracking
-			var addResp StandardResponse
-			if err := checkEmptyFlags([]string{trackingNumber}); err != nil {
-				return err
-			}
-			readConfig()
-			cParams := readValuesFromConfig()
-
-			client, err := NewClient(cParams.Address)
-			if err != nil {
-				return err
-
-			}
-			ctx := context.TODO()
-
-			//check if device id is passed
-			var payload TrackingRequestItem
-			if deviceId == "" {
-				payload = TrackingRequestItem{
-					TrackingNumber: trackingNumber,
-				}
-			} else {
-				payload = TrackingRequestItem{
-					DeviceId:       &deviceId,
-					TrackingNumber: trackingNumber,
-				}
-			}
-			client.RequestEditors = append(client.RequestEditors, setBoxeeAuthHeaders(cParams.SessionToken))
-			resp, err := client.AddTracking(ctx, payload)
-			if err != nil {
-				return err
-			}
-			body, _ := ioutil.ReadAll(resp.Body)
-			resp.Body.Close()
-			json.Unmarshal(body, &addResp)
-
-			json.NewEncoder(os.Stdout).Encode(addResp)
-			return nil
+			return o.Run(cmd.Context())
 		},
 	}
-	trackingAddCmd.Flags().StringVarP(&trackingNumber, "tracking-number", "", "", "specify a tracking number")
-	trackingAddCmd.Flags().StringVarP(&deviceId, "device-id", "", "", "specify a device id")
+	trackingAddCmd.Flags().StringVarP(&o.TrackingNumber, "tracking-number", "", "", "specify a tracking number")
+	trackingAddCmd.Flags().StringVarP(&o.DeviceID, "device-id", "", "", "specify a device id")
 	trackingAddCmd.MarkFlagRequired("tracking-number")
 	return trackingAddCmd
 }
-func trackingDelete() *cobra.Command {
-	var trackingID string
+
+// trackingDeleteOptions are the options of boxee tracking delete
+type trackingDeleteOptions struct {
+	cmdDeps
+	TrackingID string
+}
+
+func newTrackingDeleteOptions(deps cmdDeps) *trackingDeleteOptions {
+	return &trackingDeleteOptions{cmdDeps: deps}
+}
+
+func (o *trackingDeleteOptions) Run(ctx context.Context) error {
+	if err := checkEmptyFlags([]string{o.TrackingID}); err != nil {
+		return err
+	}
+	api, _, err := o.Clients.SessionClient()
+	if err != nil {
+		return err
+	}
+	deleted, err := api.Trackings.Delete(ctx, o.TrackingID)
+	if err != nil {
+		return err
+	}
+	return o.print(deleted)
+}
+
+func trackingDelete(deps cmdDeps) *cobra.Command {
+	o := newTrackingDeleteOptions(deps)
 	trackingDeleteCmd := &cobra.Command{
 		Use:   "delete",
 		Short: "delete a tracking",
 		Long: `
 		delete a tracking. Required flags include tracking id`,
 		RunE: func(cmd *cobra.Command, args []string) error {
-			//update a tracking
-			var deleteResp StandardResponse
-			if err := checkEmptyFlags([]string{trackingID}); err != nil {
-				return err
-			}
-			readConfig()
-			cParams := readValuesFromConfig()
-
-			client, err := NewClient(cParams.Address)
-			if err != nil {
-				return err
-
-			}
-			ctx := context.TODO()
-
-			client.RequestEditors = append(client.RequestEditors, setBoxeeAuthHeaders(cParams.SessionToken))
-			resp, err := client.DeleteTracking(ctx, &DeleteTrackingParams{
-				TrackingId: trackingID,
-			})
-			if err != nil {
-				return err
-			}
-			body, _ := ioutil.ReadAll(resp.Body)
-			resp.Body.Close()
-			json.Unmarshal(body, &deleteResp)
-
-			json.NewEncoder(os.Stdout).Encode(deleteResp)
-			return nil
+			return o.Run(cmd.Context())
 		},
 	}
-	trackingDeleteCmd.Flags().StringVarP(&trackingID, "id", "i", "", "specify a tracking id")
+	trackingDeleteCmd.Flags().StringVarP(&o.TrackingID, "id", "i", "", "specify a tracking id")
 	trackingDeleteCmd.MarkFlagRequired("id")
 	return trackingDeleteCmd
 }
 
-func trackingList() *cobra.Command {
-	var page int
-	var limit int
+// trackingListOptions are the options of boxee tracking list
+type trackingListOptions struct {
+	cmdDeps
+	listOptions
+	// DeviceID limits the list to the trackings of one device
+	DeviceID string
+}
+
+func newTrackingListOptions(deps cmdDeps) *trackingListOptions {
+	return &trackingListOptions{cmdDeps: deps}
+}
+
+func (o *trackingListOptions) Run(ctx context.Context) error {
+	if err := o.validate(); err != nil {
+		return err
+	}
+	api, _, err := o.Clients.SessionClient()
+	if err != nil {
+		return err
+	}
+	if stream, limit := o.streaming(); stream {
+		it := api.Trackings.Iter(o.DeviceID, boxee.IterOptions{Limit: limit, MaxItems: o.MaxItems})
+		return streamPages(ctx, o.Out, o.state.flags.Output, it)
+	}
+	list, err := api.Trackings.List(ctx, o.DeviceID, o.page())
+	if err != nil {
+		return err
+	}
+	return o.print(list)
+}
+
+func trackingList(deps cmdDeps) *cobra.Command {
+	o := newTrackingListOptions(deps)
 	trackingListCmd := &cobra.Command{
 		Use:   "list",
 		Short: "list all trackings",
+		Long: `
+		list trackings one page at a time. Pass --all to walk every page and stream the results`,
 		RunE: func(cmd *cobra.Command, args []string) error {
-			if err := readConfig(); err != nil {
-				return err
-			}
-			cParams := readValuesFromConfig()
-
-			client, err := NewClient(cParams.Address)
-			if err != nil {
-				return err
-
-			}
-			ctx := context.TODO()
-			client.RequestEditors = append(client.RequestEditors, setBoxeeAuthHeaders(cParams.SessionToken))
-
-			var payload ListTrackingsParams
-			if deviceId == "" {
-				payload = ListTrackingsParams{
-					Page:  &page,
-					Limit: &limit,
-				}
-			} else {
-				payload = ListTrackingsParams{
-					DeviceId: &deviceId,
-					Page:     &page,
-					Limit:    &limit,
-				}
-			}
-
-			resp, err := client.ListTrackings(ctx, &payload)
-			if err != nil {
-				return err
-			}
-			body, _ := ioutil.ReadAll(resp.Body)
-			resp.Body.Close()
-			switch resp.StatusCode {
-			case http.StatusOK:
-				var listResp ListTrackings
-				json.Unmarshal(body, &listResp)
-				json.NewEncoder(os.Stdout).Encode(listResp)
-			default:
-				var defaultResp StandardResponse
-				json.Unmarshal(body, &defaultResp)
-				json.NewEncoder(os.Stdout).Encode(defaultResp)
-			}
-
-			return nil
+			o.LimitSet = cmd.Flags().Changed("limit")
+			o.PageSet = cmd.Flags().Changed("page")
+			return o.Run(cmd.Context())
 		},
 	}
-	trackingListCmd.Flags().StringVarP(&deviceId, "device-id", "", "", "specify a device id")
-	trackingListCmd.Flags().IntVarP(&page, "page", "p", 1, "specify page number")
-	trackingListCmd.Flags().IntVarP(&limit, "limit", "l", 20, "specify a number of items to return")
-
+	trackingListCmd.Flags().StringVarP(&o.DeviceID, "device-id", "", "", "specify a device id")
+	o.listOptions.register(trackingListCmd)
 	return trackingListCmd
 }
+
+// trackingGetOptions are the options of boxee tracking get
+type trackingGetOptions struct {
+	cmdDeps
+	TrackingNumber string
+	// DeviceID or DeviceName select the device, the name is looked up
+	// when no id is given
+	DeviceID   string
+	DeviceName string
+}
+
+func newTrackingGetOptions(deps cmdDeps) *trackingGetOptions {
+	return &trackingGetOptions{cmdDeps: deps}
+}
+
+func (o *trackingGetOptions) Run(ctx context.Context) error {
+	if err := checkEmptyFlags([]string{o.TrackingNumber}); err != nil {
+		return err
+	}
+	if o.DeviceID == "" && o.DeviceName == "" {
+		return ErrorDeviceLookup
+	}
+	api, _, err := o.Clients.SessionClient()
+	if err != nil {
+		return err
+	}
+
+	id := o.DeviceID
+	if id == "" {
+		id, err = api.Devices.ResolveID(ctx, o.DeviceName)
+		if err != nil {
+			return err
+		}
+	}
+	tracking, err := api.Trackings.Get(ctx, o.TrackingNumber, id)
+	if err != nil {
+		return err
+	}
+	return o.print(tracking)
+}
+
+func trackingGet(deps cmdDeps) *cobra.Command {
+	o := newTrackingGetOptions(deps)
+	trackingGetCmd := &cobra.Command{
+		Use:   "get",
+		Short: "get a tracking",
+		Long: `
+		get a tracking record including creation time and pin key. Required flags include tracking number and either device id or device name`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return o.Run(cmd.Context())
+		},
+	}
+	trackingGetCmd.Flags().StringVarP(&o.TrackingNumber, "tracking-number", "", "", "specify a tracking number")
+	trackingGetCmd.Flags().StringVarP(&o.DeviceID, "device-id", "", "", "specify a device id")
+	trackingGetCmd.Flags().StringVarP(&o.DeviceName, "device-name", "", "", "specify a device name instead of a device id")
+	trackingGetCmd.MarkFlagRequired("tracking-number")
+	return trackingGetCmd
+}
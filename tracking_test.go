@@ -0,0 +1,88 @@
+package main
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/epuerta9/box-ee-cli/pkg/boxeetest"
+)
+
+func TestTrackingCommands(t *testing.T) {
+	//other@example.com owns a device without trackings
+	otherConfig := strings.Replace(loggedOutConfig, "qa@example.com", "other@example.com", 1)
+	otherLogin := [][]string{{"login", "--password", "Other-Horse-9"}}
+	runCLICases(t, []cliCase{
+		{name: "tracking/list", args: []string{"tracking", "list"}},
+		{name: "tracking/list_device", args: []string{"tracking", "list", "--device-id", "dev-0002", "-o", "wide"}},
+		{name: "tracking/list_all_csv", args: []string{"tracking", "list", "--all", "--limit", "2", "-o", "csv"}},
+		{name: "tracking/list_empty", args: []string{"tracking", "list", "-o", "table"}, config: otherConfig, before: otherLogin},
+		{name: "tracking/list_all_empty", args: []string{"tracking", "list", "--all", "-o", "table"}, config: otherConfig, before: otherLogin},
+		{name: "tracking/list_all_empty_csv", args: []string{"tracking", "list", "--all", "-o", "csv"}, config: otherConfig, before: otherLogin},
+		{name: "tracking/list_go_template", args: []string{"tracking", "list", "-o", `go-template={{range .trackings}}{{.tracking_number}} {{.pin_key}}{{"\n"}}{{end}}`}},
+		{name: "tracking/add", args: []string{"tracking", "add", "--tracking-number", "T300", "--device-id", "dev-0002"}},
+		{
+			name:   "tracking/add_then_get",
+			args:   []string{"tracking", "get", "--tracking-number", "T300", "--device-name", "locker-2"},
+			before: [][]string{{"tracking", "add", "--tracking-number", "T300", "--device-id", "dev-0002"}},
+		},
+		{name: "tracking/add_default_device", args: []string{"tracking", "add", "--tracking-number", "T300"}},
+		{name: "tracking/add_duplicate", args: []string{"tracking", "add", "--tracking-number", "T100", "--device-id", "dev-0001"}},
+		{name: "tracking/add_missing_device", args: []string{"tracking", "add", "--tracking-number", "T300", "--device-id", "dev-9999"}},
+		{name: "tracking/add_empty_number", args: []string{"tracking", "add", "--tracking-number", ""}},
+		{
+			name:  "tracking/add_post_not_retried",
+			args:  []string{"tracking", "add", "--tracking-number", "T300"},
+			setup: func(srv *boxeetest.Server) { srv.FailNext(http.StatusBadGateway, 1) },
+		},
+		{
+			name:  "tracking/add_retry_post",
+			args:  []string{"tracking", "add", "--tracking-number", "T300", "--retry-post"},
+			setup: func(srv *boxeetest.Server) { srv.FailNext(http.StatusBadGateway, 1) },
+		},
+		{name: "tracking/get", args: []string{"tracking", "get", "--tracking-number", "T100", "--device-id", "dev-0001", "-o", "yaml"}},
+		{name: "tracking/get_by_device_name", args: []string{"tracking", "get", "--tracking-number", "T200", "--device-name", "locker-2"}},
+		{name: "tracking/get_missing", args: []string{"tracking", "get", "--tracking-number", "T999", "--device-id", "dev-0001"}},
+		{name: "tracking/get_unknown_device_name", args: []string{"tracking", "get", "--tracking-number", "T100", "--device-name", "nope"}},
+		{name: "tracking/get_no_device", args: []string{"tracking", "get", "--tracking-number", "T100"}},
+		{name: "tracking/delete", args: []string{"tracking", "delete", "--id", "trk-0002"}},
+		{name: "tracking/delete_missing", args: []string{"tracking", "delete", "--id", "trk-9999"}},
+		{
+			name:  "tracking/file",
+			args:  []string{"tracking", "file", "--file", "numbers.txt", "--device-id", "dev-0002", "--concurrency", "1", "-o", "table"},
+			files: map[string]string{"numbers.txt": "T300\n\nT301\nT300\nT200\n"},
+			show:  []string{"numbers.txt.journal"},
+		},
+		{
+			name:   "tracking/file_resume",
+			args:   []string{"tracking", "file", "--file", "numbers.txt", "--resume", "-o", "table"},
+			files:  map[string]string{"numbers.txt": "T300\nT301\n", "numbers.txt.journal": `{"tracking_number":"T300","added":"2024-03-01T12:00:00Z"}` + "\n"},
+			before: [][]string{{"tracking", "add", "--tracking-number", "T300"}},
+		},
+		{
+			name:  "tracking/file_existing_journal",
+			args:  []string{"tracking", "file", "--file", "numbers.txt"},
+			files: map[string]string{"numbers.txt": "T300\n", "numbers.txt.journal": `{"tracking_number":"T300","added":"2024-03-01T12:00:00Z"}` + "\n"},
+			show:  []string{"numbers.txt.journal"},
+		},
+		{
+			name:  "tracking/file_existing_journal_force",
+			args:  []string{"tracking", "file", "--file", "numbers.txt", "--force"},
+			files: map[string]string{"numbers.txt": "T300\n", "numbers.txt.journal": `{"tracking_number":"T300","added":"2024-03-01T12:00:00Z"}` + "\n"},
+			show:  []string{"numbers.txt.journal"},
+		},
+		{
+			name:  "tracking/file_resume_other_device",
+			args:  []string{"tracking", "file", "--file", "numbers.txt", "--device-id", "dev-0002", "--resume", "-o", "table"},
+			files: map[string]string{"numbers.txt": "T300\n", "numbers.txt.journal": `{"device_id":"dev-0001","tracking_number":"T300","added":"2024-03-01T12:00:00Z"}` + "\n"},
+		},
+		{
+			name:  "tracking/file_failed",
+			args:  []string{"tracking", "file", "--file", "numbers.txt", "--device-id", "dev-0002", "--concurrency", "1"},
+			files: map[string]string{"numbers.txt": "T300\nT301\n"},
+			setup: func(srv *boxeetest.Server) { srv.FailNext(http.StatusBadRequest, 1) },
+			show:  []string{"numbers.txt.journal"},
+		},
+		{name: "tracking/file_missing", args: []string{"tracking", "file", "--file", "missing.txt"}},
+	})
+}
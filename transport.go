@@ -0,0 +1,270 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/epuerta9/box-ee-cli/pkg/boxee"
+	"github.com/spf13/cobra"
+	"gopkg.in/yaml.v3"
+)
+
+// transportConfig holds the settings of the http transport. They can be set at
+// the top level of a config file, per context and through flags
+type transportConfig struct {
+	Retry     retryPolicy       `yaml:"retry"`
+	RateLimit rateLimitConfig   `yaml:"rate_limit"`
+	TLS       tlsConfig         `yaml:"tls"`
+	Proxy     proxyConfig       `yaml:"proxy"`
+	Timeout   timeoutConfig     `yaml:"timeout"`
+	Headers   map[string]string `yaml:"headers"`
+}
+
+// proxyConfig picks the proxy. Without a url HTTP_PROXY, HTTPS_PROXY and
+// NO_PROXY are used unless from_environment is false
+type proxyConfig struct {
+	URL             string `yaml:"url"`
+	FromEnvironment bool   `yaml:"from_environment"`
+}
+
+// timeoutConfig bounds each request. Connect covers the tcp and tls
+// handshakes, read the wait for the response once the request is sent and
+// overall the whole request including reading the body. 0 disables a timeout
+type timeoutConfig struct {
+	Connect time.Duration `yaml:"connect"`
+	Read    time.Duration `yaml:"read"`
+	Overall time.Duration `yaml:"overall"`
+}
+
+func validateProxyURL(value string) error {
+	u, err := url.Parse(value)
+	if err != nil {
+		return err
+	}
+	switch u.Scheme {
+	case "http", "https", "socks5", "socks5h":
+	default:
+		return errors.New("proxy must start with http://, https://, socks5:// or socks5h://")
+	}
+	if u.Host == "" {
+		return errors.New("proxy has no host")
+	}
+	return nil
+}
+
+// transportSchema lists the transport settings for the config schema
+var transportSchema = []configKey{
+	{Name: "retry.max_retries", Type: configInt, Description: "retries after a failed request, 0 disables retries"},
+	{Name: "retry.base_delay", Type: configDuration, Description: "delay before the first retry, doubled on every attempt"},
+	{Name: "retry.max_delay", Type: configDuration, Description: "longest delay between retries and longest Retry-After honored"},
+	{Name: "retry.post", Type: configBool, Description: "also retry POST requests, which may not be idempotent"},
+	{Name: "rate_limit.rps", Type: configFloat, Description: "requests per second, 0 only slows down once the server answers 429", Validate: nonNegative},
+	{Name: "rate_limit.burst", Type: configInt, Description: "requests that may be sent at once, defaults to rps", Validate: nonNegative},
+	{Name: "tls.ca_file", Description: "PEM file of CA certificates trusted besides the system roots"},
+	{Name: "tls.ca_dir", Description: "directory of .pem, .crt or .cer CA certificates trusted besides the system roots"},
+	{Name: "tls.cert_file", Description: "PEM client certificate for mutual tls"},
+	{Name: "tls.key_file", Description: "PEM private key of the client certificate"},
+	{Name: "tls.min_version", Description: "lowest tls version accepted, 1.2 by default", Validate: validateTLSVersion},
+	{Name: "tls.server_name", Description: "name the server certificate is verified against instead of the address host"},
+	{Name: "tls.insecure_skip_verify", Type: configBool, Description: "accept any server certificate. Only for local dev servers"},
+	{Name: "proxy.url", Description: "http, https or socks5 proxy url", Validate: validateProxyURL},
+	{Name: "proxy.from_environment", Type: configBool, Description: "use HTTP_PROXY, HTTPS_PROXY and NO_PROXY when proxy.url is not set"},
+	{Name: "timeout.connect", Type: configDuration, Description: "limit for the tcp and tls handshakes"},
+	{Name: "timeout.read", Type: configDuration, Description: "limit for the response to start once the request is sent"},
+	{Name: "timeout.overall", Type: configDuration, Description: "limit for a whole request"},
+	{Name: "headers.*", Description: "extra header sent with every request", Sensitive: true},
+}
+
+// configFlag binds a global flag to a config key
+type configFlag struct {
+	Flag string
+	Key  string
+}
+
+// transportFlags are the global flags overriding transport settings
+var transportFlags = []configFlag{
+	{Flag: "retries", Key: "retry.max_retries"},
+	{Flag: "retry-post", Key: "retry.post"},
+	{Flag: "rps", Key: "rate_limit.rps"},
+	{Flag: "burst", Key: "rate_limit.burst"},
+	{Flag: "insecure-skip-verify", Key: "tls.insecure_skip_verify"},
+	{Flag: "proxy", Key: "proxy.url"},
+	{Flag: "timeout", Key: "timeout.overall"},
+}
+
+func defaultTransportConfig() transportConfig {
+	return transportConfig{
+		Retry: retryPolicy{
+			MaxRetries: 3,
+			BaseDelay:  500 * time.Millisecond,
+			MaxDelay:   30 * time.Second,
+		},
+		Proxy: proxyConfig{FromEnvironment: true},
+		Timeout: timeoutConfig{
+			Connect: 10 * time.Second,
+			Read:    30 * time.Second,
+			Overall: time.Minute,
+		},
+	}
+}
+
+func addTransportFlags(cmd *cobra.Command) {
+	cmd.PersistentFlags().Int("retries", 3, "retries after a transient error, 0 disables retries")
+	cmd.PersistentFlags().Bool("retry-post", false, "also retry POST requests, which may create duplicates")
+	cmd.PersistentFlags().Float64("rps", 0, "maximum requests per second, 0 for no limit until the server throttles")
+	cmd.PersistentFlags().Int("burst", 0, "requests that may be sent at once (default rps)")
+	cmd.PersistentFlags().Bool("insecure-skip-verify", false, "DANGEROUS: accept any server certificate, anyone on the network can read your credentials. Only for local dev servers")
+	cmd.PersistentFlags().String("proxy", "", "http, https or socks5 proxy url (default from HTTP_PROXY and HTTPS_PROXY)")
+	cmd.PersistentFlags().Duration("timeout", time.Minute, "limit for each request, 0 disables it")
+	cmd.PersistentFlags().StringArray("header", nil, `extra "Name: value" header sent with every request, can be repeated`)
+}
+
+// collectFlagLayers turns the transport flags that were passed into config
+// layers so they take precedence over files and contexts
+func (s *runState) collectFlagLayers(cmd *cobra.Command) error {
+	s.flags.layers = nil
+	for _, f := range transportFlags {
+		flag := cmd.Flags().Lookup(f.Flag)
+		if flag == nil || !flag.Changed {
+			continue
+		}
+		value, err := parseConfigValue(f.Key, flag.Value.String())
+		if err != nil {
+			return err
+		}
+		_, path, _ := lookupConfigKey(f.Key)
+		settings := map[string]interface{}{}
+		setPath(settings, path, value)
+		s.flags.layers = append(s.flags.layers, configLayer{Source: layerFlag, Origin: "--" + f.Flag, Settings: settings})
+	}
+
+	if flag := cmd.Flags().Lookup("header"); flag != nil && flag.Changed {
+		headers, err := cmd.Flags().GetStringArray("header")
+		if err != nil {
+			return err
+		}
+		for _, h := range headers {
+			name, value, ok := strings.Cut(h, ":")
+			name = strings.TrimSpace(name)
+			if !ok || name == "" {
+				return fmt.Errorf(`invalid --header %q, expected "Name: value"`, h)
+			}
+			settings := map[string]interface{}{"headers": map[string]interface{}{name: strings.TrimSpace(value)}}
+			s.flags.layers = append(s.flags.layers, configLayer{Source: layerFlag, Origin: "--header", Settings: settings})
+		}
+	}
+	return nil
+}
+
+// resolveTransportConfig applies the config files, then the settings of the
+// active context, then environment and flags onto the defaults
+func (s *runState) resolveTransportConfig(contextSettings map[string]interface{}) (transportConfig, error) {
+	tc := defaultTransportConfig()
+	var overrides []map[string]interface{}
+	for _, l := range s.config.layers {
+		if l.Source == layerEnv || l.Source == layerFlag {
+			overrides = append(overrides, l.Settings)
+			continue
+		}
+		if err := decodeSettings(l.Settings, &tc); err != nil {
+			return tc, err
+		}
+	}
+	if contextSettings != nil {
+		if err := decodeSettings(contextSettings, &tc); err != nil {
+			return tc, err
+		}
+	}
+	for _, settings := range overrides {
+		if err := decodeSettings(settings, &tc); err != nil {
+			return tc, err
+		}
+	}
+	return tc, nil
+}
+
+// decodeSettings decodes settings into out, keeping the fields they do not set
+func decodeSettings(settings map[string]interface{}, out interface{}) error {
+	raw, err := yaml.Marshal(settings)
+	if err != nil {
+		return err
+	}
+	return yaml.Unmarshal(raw, out)
+}
+
+// newHTTPDoer builds the boxee.HttpRequestDoer passed to the generated client
+func (s *runState) newHTTPDoer(tc transportConfig) (boxee.HttpRequestDoer, error) {
+	doer := s.env.HTTPClient
+	switch {
+	case s.flags.Replay != "":
+		r, err := s.sharedReplayer(s.env.workPath(s.flags.Replay))
+		if err != nil {
+			return nil, err
+		}
+		doer = replayDoer{r: r}
+	case doer == nil:
+		var err error
+		if doer, err = s.newHTTPClient(tc); err != nil {
+			return nil, err
+		}
+	}
+	if s.flags.Record != "" {
+		rec, err := s.sharedRecorder(s.env.workPath(s.flags.Record))
+		if err != nil {
+			return nil, err
+		}
+		doer = &recordingDoer{next: doer, rec: rec, secretHeaders: extraHeaderNames(tc.Headers)}
+	}
+	if s.flags.Debug || s.flags.Trace {
+		doer = &traceDoer{next: doer, w: s.env.Stderr, bodies: s.flags.Trace, secretHeaders: extraHeaderNames(tc.Headers)}
+	}
+	limited := &rateLimitedDoer{next: doer, limiter: s.sharedRateLimiter(tc.RateLimit)}
+	return newRetryingDoer(limited, tc.Retry, s.env.Stderr), nil
+}
+
+// newHTTPClient builds the http client for the proxy, tls and timeout settings
+func (s *runState) newHTTPClient(tc transportConfig) (*http.Client, error) {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.DialContext = (&net.Dialer{Timeout: tc.Timeout.Connect, KeepAlive: 30 * time.Second}).DialContext
+	transport.TLSHandshakeTimeout = tc.Timeout.Connect
+	transport.ResponseHeaderTimeout = tc.Timeout.Read
+	switch {
+	case tc.Proxy.URL != "":
+		if err := validateProxyURL(tc.Proxy.URL); err != nil {
+			return nil, fmt.Errorf("invalid proxy.url: %w", err)
+		}
+		proxyURL, _ := url.Parse(tc.Proxy.URL)
+		transport.Proxy = http.ProxyURL(proxyURL)
+	case !tc.Proxy.FromEnvironment:
+		transport.Proxy = nil
+	}
+	if !tc.TLS.isZero() {
+		tlsCfg, err := tc.TLS.build()
+		if err != nil {
+			return nil, err
+		}
+		if tlsCfg.InsecureSkipVerify {
+			fmt.Fprintln(s.env.Stderr, "WARNING: tls certificate verification is disabled. Anyone on the network can read and change the traffic, including your credentials")
+		}
+		transport.TLSClientConfig = tlsCfg
+	}
+
+	return &http.Client{Transport: transport, Timeout: tc.Timeout.Overall}, nil
+}
+
+// setExtraHeaders adds the configured headers to every request. It runs
+// before the auth editors so it cannot replace the auth headers
+func setExtraHeaders(headers map[string]string) boxee.RequestEditorFn {
+	return func(ctx context.Context, req *http.Request) error {
+		for name, value := range headers {
+			req.Header.Set(name, value)
+		}
+		return nil
+	}
+}
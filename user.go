@@ -2,146 +2,219 @@ package main
 
 import (
 	"context"
-	"encoding/json"
+	"errors"
 	"fmt"
-	"io"
-	"io/ioutil"
-	"os"
 
+	"github.com/epuerta9/box-ee-cli/pkg/boxee"
 	"github.com/spf13/cobra"
-	"github.com/spf13/viper"
 )
 
-func getLoginCmd() *cobra.Command {
-	var password string
+var (
+	ErrorEmailNotSet = errors.New("no email configured. Run boxee init or boxee config set email")
+)
+
+// loginOptions are the options of boxee login
+type loginOptions struct {
+	cmdDeps
+	Password passwordFlags
+}
+
+func newLoginOptions(deps cmdDeps) *loginOptions {
+	return &loginOptions{cmdDeps: deps}
+}
+
+func (o *loginOptions) Run(ctx context.Context) error {
+	cParams, err := o.Config()
+	if err != nil {
+		return err
+	}
+	secret, err := o.Password.read(o.state.env, o.In, false)
+	if err != nil {
+		return err
+	}
+	login, err := loginSession(ctx, o.cmdDeps, cParams, secret)
+	if err != nil {
+		return err
+	}
+	return o.print(login)
+}
+
+func getLoginCmd(deps cmdDeps) *cobra.Command {
+	o := newLoginOptions(deps)
 	loginCmd := &cobra.Command{
 		Use:   "login",
 		Short: "login to box-ee",
-		Long:  `login to the box-ee server using the config credentials`,
+		Long: `
+		login to the box-ee server with the email of the config. The password is prompted for without echo,
+		or read from stdin with --password-stdin`,
 		RunE: func(cmd *cobra.Command, args []string) error {
-
-			cParams := readValuesFromConfig()
-
-			client, err := NewClient(cParams.Address)
-			if err != nil {
-				return err
-
-			}
-
-			client.RequestEditors = append(client.RequestEditors, setRequestHeaders())
-			ctx := context.TODO()
-			resp, err := client.AdminLogin(ctx, AdminLoginRequest{
-				Email:    cParams.Email,
-				Password: password,
-			})
-			if err != nil {
-				json.NewEncoder(os.Stdout).Encode(AdminLoginResponseItem{
-					Msg:          err.Error(),
-					SessionToken: "",
-					StatusCode:   resp.StatusCode,
-				})
-			}
-			body, _ := ioutil.ReadAll(resp.Body)
-			resp.Body.Close()
-			var loginResponse AdminLoginResponseItem
-			json.Unmarshal(body, &loginResponse)
-			json.NewEncoder(os.Stdout).Encode(loginResponse)
-
-			//write to config
-			viper.Set("session_token", loginResponse.SessionToken)
-
-			return viper.WriteConfig()
-
+			o.Password.Given = cmd.Flags().Changed("password")
+			return o.Run(cmd.Context())
 		},
 	}
-	loginCmd.Flags().StringVarP(&password, "password", "p", "", "password to login to package place api")
-	loginCmd.MarkFlagRequired("password")
+	o.Password.register(loginCmd, "password to login to package place api")
 	return loginCmd
 
 }
-func getRegisterCmd() *cobra.Command {
-	var password string
-	var email string
+
+// loginSession logs in and keeps the session token and the time it was issued
+// in the credential store. Nothing is stored unless the server answered 200
+// with a session token, so a failed login keeps the previous session
+func loginSession(ctx context.Context, deps cmdDeps, cParams ConfigParams, password string) (*boxee.AdminLoginResponseItem, error) {
+	if cParams.Email == "" {
+		return nil, ErrorEmailNotSet
+	}
+	api, err := deps.Clients.Client(cParams)
+	if err != nil {
+		return nil, err
+	}
+	login, err := api.Auth.Login(ctx, cParams.Email, password)
+	switch {
+	case errors.Is(err, boxee.ErrAccountLocked):
+		return nil, fmt.Errorf("%w. Wait before trying again or run boxee recover", err)
+	case errors.Is(err, boxee.ErrEmptySessionToken):
+		return nil, fmt.Errorf("%w. The stored session was left unchanged", err)
+	case err != nil:
+		return nil, err
+	}
+
+	store, err := deps.state.configuredCredentialStore()
+	if err != nil {
+		return nil, err
+	}
+	if err := storeSession(store, cParams, login.SessionToken); err != nil {
+		return nil, err
+	}
+	return login, nil
+}
+
+// storeSession writes the session token and the time it was issued. The
+// stores have no transactions, so the previous token is put back when the
+// issue time cannot be written
+func storeSession(store credentialStore, cParams ConfigParams, token string) error {
+	tokenName := credentialName(cParams, credSessionToken)
+	previous, err := store.Get(tokenName)
+	if err != nil && !errors.Is(err, ErrCredentialNotFound) {
+		return err
+	}
+	if err := store.Set(tokenName, token); err != nil {
+		return err
+	}
+	if err := store.Set(credentialName(cParams, credSessionIssued), sessionIssuedNow()); err != nil {
+		restore := store.Delete(tokenName)
+		if previous != "" {
+			restore = store.Set(tokenName, previous)
+		}
+		if restore != nil {
+			return fmt.Errorf("%w. Restoring the previous session token also failed: %v", err, restore)
+		}
+		return err
+	}
+	return nil
+}
+
+// registerOptions are the options of boxee register
+type registerOptions struct {
+	cmdDeps
+	Password passwordFlags
+	// Email wins over the email in the config
+	Email             string
+	SkipStrengthCheck bool
+}
+
+func newRegisterOptions(deps cmdDeps) *registerOptions {
+	return &registerOptions{cmdDeps: deps}
+}
+
+func (o *registerOptions) Run(ctx context.Context) error {
+	cParams, err := o.Config()
+	if err != nil {
+		return err
+	}
+	cParams.Email = o.Email
+
+	secret, err := o.Password.read(o.state.env, o.In, true)
+	if err != nil {
+		return err
+	}
+	if !o.SkipStrengthCheck {
+		if err := checkPasswordStrength(secret, cParams.Email); err != nil {
+			return err
+		}
+	}
+
+	api, err := o.Clients.Client(cParams)
+	if err != nil {
+		return err
+	}
+	registered, err := api.Auth.Register(ctx, cParams.Email, secret)
+	if err != nil {
+		return err
+	}
+	return o.print(registered)
+}
+
+func getRegisterCmd(deps cmdDeps) *cobra.Command {
+	o := newRegisterOptions(deps)
 	registerCmd := &cobra.Command{
 		Use:   "register",
 		Short: "register to box-ee",
-		Long:  `register to the box-ee servers`,
+		Long: `
+		register to the box-ee servers. The password is prompted for twice without echo, or read from stdin
+		with --password-stdin, and has to pass a strength check unless --skip-strength-check is set`,
 		RunE: func(cmd *cobra.Command, args []string) error {
-			if err := readConfig(); err != nil {
-				return err
-			}
-			//check email in config. If not equal then replace config email with new one
-			if viper.Get("email") != email {
-				viper.Set("email", email)
-			}
-			cParams := readValuesFromConfig()
-
-			client, err := NewClient(cParams.Address)
-			if err != nil {
-				return err
-
-			}
-			ctx := context.TODO()
-			//todo register needs an admin type request
-			_, err = client.AdminRegister(ctx, AdminLoginRequest{
-				Email:    cParams.Email,
-				Password: password,
-			})
-			if err != nil {
-				fmt.Println("error ", err)
-				return err
-			}
-			return nil
-
+			o.Password.Given = cmd.Flags().Changed("password")
+			return o.Run(cmd.Context())
 		},
 	}
-	registerCmd.Flags().StringVarP(&password, "password", "p", "", "password to login to box-ee api")
-	registerCmd.Flags().StringVarP(&email, "email", "e", "", "email to login to box-ee api")
-	registerCmd.MarkFlagRequired("password")
+	o.Password.register(registerCmd, "password to login to box-ee api")
+	registerCmd.Flags().StringVarP(&o.Email, "email", "e", "", "email to login to box-ee api")
+	registerCmd.Flags().BoolVarP(&o.SkipStrengthCheck, "skip-strength-check", "", false, "register even when the password looks weak")
 	registerCmd.MarkFlagRequired("email")
 	return registerCmd
 
 }
-func getRecoverCmd() *cobra.Command {
-	var email string
+
+// recoverOptions are the options of boxee recover
+type recoverOptions struct {
+	cmdDeps
+	// Email wins over the email in the config
+	Email string
+}
+
+func newRecoverOptions(deps cmdDeps) *recoverOptions {
+	return &recoverOptions{cmdDeps: deps}
+}
+
+func (o *recoverOptions) Run(ctx context.Context) error {
+	cParams, err := o.Config()
+	if err != nil {
+		return err
+	}
+	cParams.Email = o.Email
+
+	api, err := o.Clients.Client(cParams)
+	if err != nil {
+		return err
+	}
+	recovered, err := api.Auth.Recover(ctx, cParams.Email)
+	if err != nil {
+		return err
+	}
+	return o.print(recovered)
+}
+
+func getRecoverCmd(deps cmdDeps) *cobra.Command {
+	o := newRecoverOptions(deps)
 	recoverCmd := &cobra.Command{
 		Use:   "recover",
 		Short: "recover account for box-ee",
 		Long:  `recover password for box-ee servers`,
 		RunE: func(cmd *cobra.Command, args []string) error {
-			if err := readConfig(); err != nil {
-				return err
-			}
-			//check email in config. If not equal then replace config email with new one
-			if viper.Get("email") != email {
-				viper.Set("email", email)
-			}
-			cParams := readValuesFromConfig()
-
-			client, err := NewClient(cParams.Address)
-			if err != nil {
-				return err
-
-			}
-			ctx := context.TODO()
-			//todo register needs an admin type request
-			resp, err := client.AdminRecover(ctx, AdminRecoverRequest{
-				Email: cParams.Email,
-			})
-			if err != nil {
-				fmt.Println("error ", err)
-				return err
-			}
-			var r map[string]interface{}
-			defer resp.Body.Close()
-			b, _ := io.ReadAll(resp.Body)
-			json.Unmarshal(b, &r)
-			fmt.Println(r)
-			return nil
-
+			return o.Run(cmd.Context())
 		},
 	}
-	recoverCmd.Flags().StringVarP(&email, "email", "e", "", "email to send recovery link")
+	recoverCmd.Flags().StringVarP(&o.Email, "email", "e", "", "email to send recovery link")
 	recoverCmd.MarkFlagRequired("email")
 	return recoverCmd
 
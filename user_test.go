@@ -0,0 +1,118 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"testing"
+
+	"github.com/epuerta9/box-ee-cli/pkg/boxeetest"
+)
+
+func TestUserCommands(t *testing.T) {
+	strict := map[string]string{strictSecretsEnvName: "1"}
+	runCLICases(t, []cliCase{
+		{name: "login/password_stdin", args: []string{"login", "--password-stdin"}, stdin: "Correct-Horse-9\n", config: loggedOutConfig, show: []string{configFile}},
+		{name: "login/password_flag", args: []string{"login", "--password", "Correct-Horse-9"}, config: loggedOutConfig},
+		{name: "login/password_flag_strict", args: []string{"login", "--password", "Correct-Horse-9"}, config: loggedOutConfig, env: strict},
+		{name: "login/both_sources", args: []string{"login", "--password", "x", "--password-stdin"}, config: loggedOutConfig},
+		{name: "login/empty_stdin", args: []string{"login", "--password-stdin"}, config: loggedOutConfig},
+		{name: "login/no_terminal", args: []string{"login"}, config: loggedOutConfig},
+		{name: "login/wrong_password", args: []string{"login", "--password-stdin"}, stdin: "nope\n", show: []string{configFile}},
+		{
+			name:   "login/locked",
+			args:   []string{"login", "--password-stdin"},
+			stdin:  "Correct-Horse-9\n",
+			config: loggedOutConfig,
+			setup:  func(srv *boxeetest.Server) { srv.FailNext(http.StatusLocked, 1) },
+		},
+		{
+			name:   "login/throttled",
+			args:   []string{"login", "--password-stdin"},
+			stdin:  "Correct-Horse-9\n",
+			config: loggedOutConfig,
+			setup:  func(srv *boxeetest.Server) { srv.FailNext(http.StatusTooManyRequests, 1) },
+		},
+		{name: "login/no_email", args: []string{"login", "--password-stdin"}, stdin: "x\n", config: "address: http://boxee.test\n"},
+		{
+			name:   "login/then_whoami",
+			args:   []string{"whoami", "-o", "yaml"},
+			config: loggedOutConfig,
+			before: [][]string{{"login", "--password", "Correct-Horse-9"}},
+		},
+		{name: "register", args: []string{"register", "--email", "new@example.com", "--password-stdin"}, stdin: "Quiet-Harbor-52\n", config: loggedOutConfig},
+		{name: "register/weak", args: []string{"register", "--email", "new@example.com", "--password-stdin"}, stdin: "password\n", config: loggedOutConfig},
+		{name: "register/skip_strength_check", args: []string{"register", "--email", "new@example.com", "--password-stdin", "--skip-strength-check"}, stdin: "password\n", config: loggedOutConfig},
+		{name: "register/existing", args: []string{"register", "--email", "qa@example.com", "--password-stdin"}, stdin: "Quiet-Harbor-52\n", config: loggedOutConfig},
+		{name: "register/no_email", args: []string{"register", "--password-stdin"}, stdin: "Quiet-Harbor-52\n", config: loggedOutConfig},
+		{name: "recover", args: []string{"recover", "--email", "qa@example.com"}, config: loggedOutConfig},
+		{name: "recover/invalid_email", args: []string{"recover", "--email", "nope"}, config: loggedOutConfig},
+		{name: "whoami", args: []string{"whoami"}},
+		{name: "whoami/expired", args: []string{"whoami"}, setup: func(srv *boxeetest.Server) { srv.Reset() }},
+		{name: "whoami/not_logged_in", args: []string{"whoami"}, config: loggedOutConfig},
+		{name: "logout", args: []string{"logout", "-o", "table"}, show: []string{configFile}},
+		{
+			name:   "logout/then_device_list",
+			args:   []string{"device", "list"},
+			before: [][]string{{"logout"}},
+		},
+		{name: "logout/not_logged_in", args: []string{"logout"}, config: loggedOutConfig},
+	})
+}
+
+// failingStore is an in memory credentialStore that fails to write failName
+type failingStore struct {
+	secrets  map[string]string
+	failName string
+}
+
+func (s failingStore) Get(name string) (string, error) {
+	v, ok := s.secrets[name]
+	if !ok {
+		return "", ErrCredentialNotFound
+	}
+	return v, nil
+}
+
+func (s failingStore) Set(name, value string) error {
+	if name == s.failName {
+		return errors.New("disk full")
+	}
+	s.secrets[name] = value
+	return nil
+}
+
+func (s failingStore) Delete(name string) error {
+	delete(s.secrets, name)
+	return nil
+}
+
+func TestStoreSessionRollback(t *testing.T) {
+	cParams := ConfigParams{CredentialRef: "qa"}
+	tokenName := credentialName(cParams, credSessionToken)
+	issuedName := credentialName(cParams, credSessionIssued)
+	cases := []struct {
+		name     string
+		previous map[string]string
+		want     map[string]string
+	}{
+		{name: "no previous session", previous: map[string]string{}, want: map[string]string{}},
+		{name: "previous session", previous: map[string]string{tokenName: "sess_old"}, want: map[string]string{tokenName: "sess_old"}},
+	}
+	for _, c := range cases {
+		store := failingStore{secrets: c.previous, failName: issuedName}
+		if err := storeSession(store, cParams, "sess_new"); err == nil {
+			t.Errorf("%v: storeSession succeeded although the issue time could not be written", c.name)
+		}
+		if len(store.secrets) != len(c.want) || store.secrets[tokenName] != c.want[tokenName] {
+			t.Errorf("%v: store holds %v, want %v", c.name, store.secrets, c.want)
+		}
+	}
+
+	store := failingStore{secrets: map[string]string{tokenName: "sess_old"}}
+	if err := storeSession(store, cParams, "sess_new"); err != nil {
+		t.Fatal(err)
+	}
+	if store.secrets[tokenName] != "sess_new" || store.secrets[issuedName] == "" {
+		t.Errorf("store holds %v, want the new token and its issue time", store.secrets)
+	}
+}
@@ -1,17 +1,17 @@
 package main
 
 import (
-	"context"
 	"errors"
-	"net/http"
-
-	"github.com/spf13/viper"
+	"fmt"
 )
 
 type ConfigParams struct {
-	Email        string
-	SessionToken string
-	Address      string
+	Email         string
+	SessionToken  string
+	Address       string
+	Context       string
+	CredentialRef string
+	Transport     transportConfig
 }
 
 //
@@ -29,42 +29,25 @@ type ConfigParams struct {
 //	return trackingResponse
 //}
 
-func checkAddressSet() bool {
-	if Address == "" {
-		return false
-
+// readCredential resolves a secret through the credential store. A token still
+// sitting in the config file is used as a fallback until it is migrated
+func (s *runState) readCredential(cParams ConfigParams, name string) (string, error) {
+	store, err := s.configuredCredentialStore()
+	if err != nil {
+		return "", err
 	}
-	return true
-}
-
-func readValuesFromConfig() ConfigParams {
-	readConfig()
-	email := viper.GetString("email")
-	address := viper.GetString("address")
-
-	sessionToken := viper.GetString("session_token")
-
-	return ConfigParams{
-		Email:        email,
-		Address:      address,
-		SessionToken: sessionToken,
+	value, err := store.Get(credentialName(cParams, name))
+	if err == nil {
+		return value, nil
 	}
-}
-
-func setRequestHeaders() RequestEditorFn {
-	return func(ctx context.Context, req *http.Request) error {
-		req.Header.Set("Content-Type", "application/json")
-		return nil
+	if !errors.Is(err, ErrCredentialNotFound) {
+		return "", err
 	}
-}
-
-func setBoxeeAuthHeaders(token string) RequestEditorFn {
-	return func(ctx context.Context, req *http.Request) error {
-		if token == "" {
-			return errors.New("empty token in X-Boxee-Auth header")
+	if legacy := s.viper.GetString(name); legacy != "" {
+		if s.configuredCredentialStoreKind() != storePlaintext {
+			fmt.Fprintf(s.env.Stderr, "warning: %v is stored in plaintext in the config file. Run boxee credentials migrate to move it into the credential store\n", name)
 		}
-		req.Header.Set("Content-Type", "application/json")
-		req.Header.Set("X-Boxee-Auth", token)
-		return nil
+		return legacy, nil
 	}
+	return "", nil
 }